@@ -0,0 +1,91 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// expandAlias replaces the command at the beginning of args by its alias in
+// the configuration, if it is not a command itself. An alias is defined in
+// the table [alias], or with a dotted key:
+//
+//	alias.day = "report -from 2024-05-01 -group-by tag"
+//
+// Aliases may refer to other aliases, as long as they do not form a loop.
+func expandAlias(args []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for len(args) > 0 && which[args[0]] == nil {
+		name := args[0]
+		alias, ok := config["alias."+name]
+		if !ok {
+			break
+		}
+		if seen[name] {
+			return nil, fmt.Errorf(tr("alias %s refers to itself"), name)
+		}
+		seen[name] = true
+
+		expansion, err := splitArgs(alias)
+		if err != nil {
+			return nil, fmt.Errorf("alias %s: %v", name, err)
+		}
+		if len(expansion) == 0 {
+			return nil, fmt.Errorf(tr("alias %s is empty"), name)
+		}
+		args = append(expansion, args[1:]...)
+	}
+	return args, nil
+}
+
+// splitArgs splits s into arguments at white space, like a shell would.
+// Arguments may be quoted with single or double quotes, and a backslash
+// escapes the next character outside of single quotes.
+func splitArgs(s string) ([]string, error) {
+	var (
+		args  []string
+		arg   strings.Builder
+		inArg bool
+		quote rune
+	)
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'' && r != '\'':
+			arg.WriteRune(r)
+		case r == '\\' && quote != '\'':
+			i++
+			if i == len(runes) {
+				return nil, errors.New(tr("trailing backslash"))
+			}
+			arg.WriteRune(runes[i])
+			inArg = true
+		case r == quote:
+			quote = 0
+		case quote == 0 && (r == '\'' || r == '"'):
+			quote = r
+			inArg = true
+		case quote == 0 && (r == ' ' || r == '\t' || r == '\n'):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New(tr("unterminated quote"))
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Annotate changes the note and tags of the entries whose IDs are given as
+// argument, as shown by list. The IDs are given as a comma-separated list of
+// IDs and ranges, such as 3,5-8, or as "all". Only those entries that also
+// match the filter options are changed, so that
+//
+//	track annotate all -from 2024-05-01 -tag clientA -note "Sprint 3"
+//
+// annotates all entries of clientA since May. The -note option replaces the
+// note, and the -add-tag and -remove-tag options change the tags.
+func Annotate() error {
+	if !isFlagSet("note") && len(addTagFlag) == 0 && len(removeTagFlag) == 0 {
+		return errors.New(tr("nothing to annotate: use -note, -add-tag, or -remove-tag"))
+	}
+	selected, err := parseIDs(cmdArgs[0])
+	if err != nil {
+		return err
+	}
+	match, err := entryFilter()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(pathArg)
+	if err != nil {
+		return err
+	}
+	blocks, err := readBlocks(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	var n, id int
+	for i := range blocks {
+		b := &blocks[i]
+		if b.record == nil {
+			continue
+		}
+		id++
+		if !selected(id) || !complete(b.record) && !begun(b.record) {
+			continue
+		}
+		e, err := parseEntry(b.record, b.line)
+		if err != nil {
+			return &LineError{b.line, err}
+		}
+		e.ID = id
+		if !match(&e) {
+			continue
+		}
+
+		if isFlagSet("note") {
+			e.Note = noteFlag
+		}
+		var tags []string
+		for _, t := range e.Tags {
+			if !containsString(removeTagFlag, t) {
+				tags = append(tags, t)
+			}
+		}
+		for _, t := range addTagFlag {
+			if !containsString(tags, t) {
+				tags = append(tags, t)
+			}
+		}
+		e.Tags = tags
+		b.record = e.Record()
+		n++
+	}
+	if n == 0 {
+		return errors.New(tr("no entries to annotate"))
+	}
+	if err = writeBlocks(pathArg, blocks); err != nil {
+		return err
+	}
+	inform(fmt.Sprintf(tr("ANNOTATED %d"), n))
+	return nil
+}
+
+// parseIDs parses a list of entry IDs such as 3,5-8 or "all", and returns a
+// function that returns true for the IDs in the list.
+func parseIDs(s string) (func(id int) bool, error) {
+	if s == "all" {
+		return func(int) bool { return true }, nil
+	}
+
+	type span struct{ from, to int }
+	var spans []span
+	for _, part := range strings.Split(s, ",") {
+		from, to := part, part
+		if i := strings.IndexByte(part, '-'); i > 0 {
+			from, to = part[:i], part[i+1:]
+		}
+		a, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, fmt.Errorf(tr("invalid entry ID %q"), part)
+		}
+		b, err := strconv.Atoi(to)
+		if err != nil || b < a {
+			return nil, fmt.Errorf(tr("invalid entry ID %q"), part)
+		}
+		spans = append(spans, span{a, b})
+	}
+	return func(id int) bool {
+		for _, sp := range spans {
+			if sp.from <= id && id <= sp.to {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// containsString returns true if list contains s.
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The shares of a budget at which a warning is given.
+var budgetAlerts = []int{80, 100}
+
+// loadBudgets returns the time that may be spent on each tag in a month,
+// which is given by the table [budgets] in the configuration:
+//
+//	[budgets]
+//	clientA = "40h"
+//	"clientB:support" = "10h"
+//
+// The time spent on a tag includes the time spent on the tags below it.
+func loadBudgets() (map[string]time.Duration, error) {
+	table := configTable("budgets")
+	if len(table) == 0 {
+		return nil, nil
+	}
+	budgets := make(map[string]time.Duration, len(table))
+	for tag, v := range table {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf(tr("config: budgets.%s is not a duration: %q"), tag, v)
+		}
+		budgets[tag] = d
+	}
+	return budgets, nil
+}
+
+// spentInMonth returns the time spent on tag in the entries that begin in
+// the same month as t.
+func spentInMonth(entries []Entry, tag string, t time.Time) time.Duration {
+	var sum time.Duration
+	for i := range entries {
+		e := &entries[i]
+		if sameMonth(e.Begin, t) && e.HasTag(tag) {
+			sum += e.Duration()
+		}
+	}
+	return sum
+}
+
+// sameMonth returns true if t and u lie in the same month in local time.
+func sameMonth(t, u time.Time) bool {
+	ty, tm, _ := t.Local().Date()
+	uy, um, _ := u.Local().Date()
+	return ty == uy && tm == um
+}
+
+// percentOf returns how many percent of total d is.
+func percentOf(d, total time.Duration) int {
+	return int(int64(d) * 100 / int64(total))
+}
+
+// warnBudgets warns about each budget of the tags of e that reached one of
+// the budgetAlerts through e, which is the last entry in entries.
+func warnBudgets(entries []Entry, e *Entry) error {
+	budgets, err := loadBudgets()
+	if err != nil {
+		return err
+	}
+	for _, tag := range budgetTags(budgets) {
+		if !e.HasTag(tag) {
+			continue
+		}
+		after := spentInMonth(entries, tag, e.Begin)
+		before := after - e.Duration()
+		for _, p := range budgetAlerts {
+			limit := budgets[tag] * time.Duration(p) / 100
+			if before < limit && after >= limit {
+				warnBudget(tag, after, budgets[tag])
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// warnBudget warns that spent is a large share of the budget for tag.
+func warnBudget(tag string, spent, budget time.Duration) {
+	if spent >= budget {
+		warn("%s is over its monthly budget of %s by %s", tag, formatDuration(budget),
+			formatDuration(spent-budget))
+	} else {
+		warn("%s has used %d%% of its monthly budget of %s", tag, percentOf(spent, budget),
+			formatDuration(budget))
+	}
+}
+
+// budgetTags returns the tags that have a budget in order.
+func budgetTags(budgets map[string]time.Duration) []string {
+	tags := make([]string, 0, len(budgets))
+	for tag := range budgets {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return lessTag(tags[i], tags[j]) })
+	return tags
+}
+
+// monthsBetween returns the number of months from the month of from to the
+// month of to, counting both.
+func monthsBetween(from, to time.Time) int {
+	fy, fm, _ := from.Local().Date()
+	ty, tm, _ := to.Local().Date()
+	return (ty-fy)*12 + int(tm-fm) + 1
+}
@@ -0,0 +1,285 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The strategies that can be used to resolve two overlapping entries.
+const (
+	overlapAsk      = "ask"      // ask the user what to do with each overlap
+	overlapKeep     = "keep"     // leave both entries as they are
+	overlapTruncate = "truncate" // end the earlier entry where the later one begins
+	overlapDelete   = "delete"   // delete the shorter of the two entries
+	overlapSplit    = "split"    // split the overlapping time between the entries
+)
+
+// validOverlap returns an error if s is not an overlap strategy.
+func validOverlap(s string) error {
+	switch s {
+	case overlapAsk, overlapKeep, overlapTruncate, overlapDelete, overlapSplit:
+		return nil
+	}
+	return fmt.Errorf(tr("unknown overlap strategy %q"), s)
+}
+
+// Clean sorts the entries in the times file chronologically and resolves
+// any overlapping entries according to the -overlap option. Entries that
+// are shorter than the -min-duration option are removed.
+//
+// The sort is stable and comment lines stay with the entry that follows
+// them, so cleaning a file that is already clean leaves it unchanged.
+func Clean() error {
+	if err := validOverlap(overlapFlag); err != nil {
+		return err
+	}
+
+	entries, tail, err := loadEntries(pathArg)
+	if err != nil {
+		return err
+	}
+	if minDurationFlag > 0 {
+		var rest []string
+		entries, rest = dropShort(entries, minDurationFlag)
+		if rest != nil {
+			tail = append([]block{{comments: rest}}, tail...)
+		}
+	}
+	entries, err = resolveOverlaps(entries, chooseOverlap)
+	if err != nil {
+		return err
+	}
+	if err = saveEntries(pathArg, entries, tail); err != nil {
+		return err
+	}
+	inform("CLEAN")
+	return nil
+}
+
+// loadEntries reads the times file at path in order to rewrite it. The
+// complete entries are returned with their comments, while the begun entry
+// and any comments after it, which stay at the end of the file, are returned
+// in tail. The file may not contain any other invalid entries.
+func loadEntries(path string) (entries []Entry, tail []block, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	_, err = readEntries(f)
+	if err != nil {
+		if ferr, ok := err.(*FormatError); !ok || !ferr.JustIncomplete() {
+			return nil, nil, err
+		}
+	}
+	f.Seek(0, 0)
+	blocks, err := readBlocks(f)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for len(blocks) > 0 {
+		if b := blocks[len(blocks)-1]; complete(b.record) {
+			break
+		}
+		tail = append([]block{blocks[len(blocks)-1]}, tail...)
+		blocks = blocks[:len(blocks)-1]
+	}
+
+	entries = make([]Entry, len(blocks))
+	for i, b := range blocks {
+		entries[i], err = parseEntry(b.record, b.line)
+		if err != nil {
+			return nil, nil, &LineError{b.line, err}
+		}
+		entries[i].Comments = b.comments
+		entries[i].Fields = b.fields
+	}
+	return entries, tail, nil
+}
+
+// saveEntries replaces the contents of the times file at path with entries,
+// followed by tail.
+func saveEntries(path string, entries []Entry, tail []block) error {
+	blocks := make([]block, 0, len(entries)+len(tail))
+	for i := range entries {
+		blocks = append(blocks, block{
+			comments: entries[i].Comments,
+			record:   entries[i].Record(),
+			fields:   entries[i].Fields,
+		})
+	}
+	return writeBlocks(path, append(blocks, tail...))
+}
+
+// dropShort returns the entries that last at least min. The comments of the
+// entries that are dropped are kept with the entry that follows them, and
+// those after the last entry that is kept are returned in rest, so that they
+// can stay where they were in the file.
+func dropShort(entries []Entry, min time.Duration) (kept []Entry, rest []string) {
+	kept = entries[:0]
+	var comments []string
+	for _, e := range entries {
+		if e.Duration() < min {
+			comments = append(comments, e.Comments...)
+			continue
+		}
+		if comments != nil {
+			e.Comments = append(comments, e.Comments...)
+			comments = nil
+		}
+		kept = append(kept, e)
+	}
+	return kept, comments
+}
+
+// An overlap is a pair of entries where the later one begins before the
+// earlier one ends.
+type overlap struct {
+	Earlier, Later *Entry
+}
+
+func (o *overlap) String() string {
+	end := o.Earlier.End
+	if o.Later.End.Before(end) {
+		end = o.Later.End
+	}
+	return fmt.Sprintf(tr("line %d overlaps line %d by %s"), o.Later.Line, o.Earlier.Line,
+		end.Sub(o.Later.Begin))
+}
+
+// findOverlaps returns the overlaps between entries, in the order of the
+// later entries in the file, leaving out those of the duplicates in dupes.
+// Each entry is compared with the entry before it that ends last.
+func findOverlaps(entries []Entry, dupes []duplicate) []overlap {
+	skip := make(map[*Entry]bool, len(dupes))
+	for _, d := range dupes {
+		skip[d.Dup] = true
+	}
+	sorted := make([]*Entry, 0, len(entries))
+	for i := range entries {
+		if e := &entries[i]; !skip[e] {
+			sorted = append(sorted, e)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Begin.Before(sorted[j].Begin)
+	})
+
+	var overlaps []overlap
+	var last *Entry
+	for _, e := range sorted {
+		if last != nil && e.Begin.Before(last.End) {
+			overlaps = append(overlaps, overlap{last, e})
+		}
+		if last == nil || e.End.After(last.End) {
+			last = e
+		}
+	}
+	sort.Slice(overlaps, func(i, j int) bool { return overlaps[i].Later.Line < overlaps[j].Later.Line })
+	return overlaps
+}
+
+// resolveOverlaps sorts entries chronologically and resolves each pair of
+// overlapping entries with the strategy that choose returns for them.
+//
+// Entries are compared with the entry that precedes them after all earlier
+// overlaps have been resolved, so if every overlap is resolved with a
+// strategy other than keep, the result contains no overlaps at all.
+func resolveOverlaps(entries []Entry, choose func(a, b *Entry) (string, error)) ([]Entry, error) {
+	sort.Stable(byBegin(entries))
+
+	out := make([]Entry, 0, len(entries))
+	for len(entries) > 0 {
+		b := entries[0]
+		entries = entries[1:]
+
+		n := len(out)
+		if n == 0 || !b.Begin.Before(out[n-1].End) {
+			out = append(out, b)
+			continue
+		}
+
+		a := &out[n-1]
+		strategy, err := choose(a, &b)
+		if err != nil {
+			return nil, err
+		}
+		switch strategy {
+		case overlapKeep:
+			out = append(out, b)
+		case overlapTruncate:
+			a.End = b.Begin
+			if !a.End.After(a.Begin) {
+				out = out[:n-1]
+			}
+			out = append(out, b)
+		case overlapDelete:
+			comments := append(a.Comments, b.Comments...)
+			if b.Duration() > a.Duration() {
+				*a = b
+			}
+			a.Comments = comments
+		case overlapSplit:
+			if a.End.After(b.End) {
+				// The later entry lies within the earlier one, so the
+				// earlier entry is split into two around it.
+				tail := *a
+				tail.Begin = b.End
+				tail.Line = 0
+				tail.Comments = nil
+				i := sort.Search(len(entries), func(i int) bool {
+					return !entries[i].Begin.Before(tail.Begin)
+				})
+				entries = append(entries[:i], append([]Entry{tail}, entries[i:]...)...)
+				a.End = b.Begin
+			} else {
+				mid := b.Begin.Add(a.End.Sub(b.Begin) / 2)
+				a.End, b.Begin = mid, mid
+			}
+			if !a.End.After(a.Begin) {
+				out = out[:n-1]
+			}
+			out = append(out, b)
+		default:
+			return nil, fmt.Errorf(tr("unknown overlap strategy %q"), strategy)
+		}
+	}
+	return out, nil
+}
+
+// chooseOverlap returns the strategy given by the -overlap option, asking
+// the user on the terminal if it is "ask".
+func chooseOverlap(a, b *Entry) (string, error) {
+	if overlapFlag != overlapAsk {
+		return overlapFlag, nil
+	}
+
+	fmt.Printf(tr("Line %d: %s")+"\n", a.Line, a)
+	fmt.Printf(tr("Line %d: %s")+"\n", b.Line, b)
+	for {
+		fmt.Print(tr("Overlap: [t]runcate earlier, [d]elete shorter, [s]plit, [k]eep? "))
+		answer, err := stdin.ReadString('\n')
+		if err != nil {
+			return "", errors.New(tr("no answer given for overlap"))
+		}
+		switch strings.TrimSpace(answer) {
+		case tr("t"):
+			return overlapTruncate, nil
+		case tr("d"):
+			return overlapDelete, nil
+		case tr("s"):
+			return overlapSplit, nil
+		case tr("k"):
+			return overlapKeep, nil
+		}
+	}
+}
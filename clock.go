@@ -0,0 +1,79 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+// ntpEpoch is the beginning of NTP time, 1900-01-01 00:00:00 UTC.
+var ntpEpoch = time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ntpTime converts a 64-bit NTP timestamp to a time.
+func ntpTime(b []byte) time.Time {
+	sec := binary.BigEndian.Uint32(b[0:4])
+	frac := binary.BigEndian.Uint32(b[4:8])
+	nsec := (int64(frac) * 1e9) >> 32
+	return ntpEpoch.Add(time.Duration(sec)*time.Second + time.Duration(nsec))
+}
+
+// queryNTP returns the offset of the local clock from the clock of the NTP
+// server at host, so that time.Now().Add(offset) is the server's time.
+func queryNTP(host string) (offset time.Duration, err error) {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(host, "123"), 2*time.Second)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	// A client request in SNTP version 3 only needs the first byte to be set.
+	req := make([]byte, 48)
+	req[0] = 3<<3 | 3
+	t0 := time.Now()
+	if _, err = conn.Write(req); err != nil {
+		return
+	}
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	t3 := time.Now()
+	if err != nil {
+		return
+	}
+	if n < 48 || resp[0]&7 != 4 {
+		return 0, errors.New(tr("invalid response from NTP server"))
+	}
+
+	t1, t2 := ntpTime(resp[32:40]), ntpTime(resp[40:48])
+	return (t1.Sub(t0) + t2.Sub(t3)) / 2, nil
+}
+
+// checkSkew warns if the clock seems to be off by more than the -skew
+// option before a timestamp is written to f. The modification time of f
+// should never lie in the future, and if the -ntp option is given, the
+// clock is also compared with that NTP server.
+func checkSkew(f *os.File, now time.Time) {
+	if fi, err := f.Stat(); err == nil && fi.ModTime().Sub(now) > skewFlag {
+		warn("%s was modified at %s, which is later than the clock",
+			f.Name(), fi.ModTime().Format(timeFormat))
+	}
+
+	if ntpFlag == "" {
+		return
+	}
+	offset, err := queryNTP(ntpFlag)
+	if err != nil {
+		warn("cannot check the clock: %v", err)
+		return
+	}
+	if offset > skewFlag || -offset > skewFlag {
+		warn("the clock differs from %s by %s",
+			ntpFlag, offset.Round(time.Second))
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// config holds the settings from the configuration file by their full key,
+// such as "rates.clientA" for the key clientA in the table [rates].
+var config = make(map[string]string)
+
+// defaultConfigPath returns the path of the configuration file that is used
+// if the -config option is not given.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "track", "config.toml")
+}
+
+// localConfigName is the name of the configuration file of a project, such
+// as a repository, which applies to its directory and everything below it.
+const localConfigName = ".track.toml"
+
+// loadConfig reads the configuration file at path into config, followed by
+// the project configuration found in the current directory or the closest
+// directory above it, which takes precedence. Anything that was loaded
+// before is forgotten. It is not an error if the default configuration
+// file does not exist.
+//
+// The key file gives the times file that is used if none is given on the
+// command line, and the key holiday-file the calendar of holidays. A
+// relative path is relative to the configuration file that it is in.
+func loadConfig(path string) error {
+	config = make(map[string]string)
+	if err := readConfig(path, path == defaultConfigPath()); err != nil {
+		return err
+	}
+	local, err := findLocalConfig()
+	if err != nil || local == "" {
+		return err
+	}
+	return readConfig(local, false)
+}
+
+// readConfig reads the configuration file at path into config.
+func readConfig(path string, optional bool) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && optional {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	conf := make(map[string]string)
+	if err = parseConfig(f, conf); err != nil {
+		return fmt.Errorf("%s:%v", path, err)
+	}
+	for _, key := range []string{"file", "holiday-file"} {
+		if file, ok := conf[key]; ok && !filepath.IsAbs(file) {
+			conf[key] = filepath.Join(filepath.Dir(path), file)
+		}
+	}
+	for k, v := range conf {
+		config[k] = v
+	}
+	return nil
+}
+
+// findLocalConfig returns the path of the project configuration file in the
+// current directory or the closest directory above it, or "" if there is none.
+func findLocalConfig() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, localConfigName)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// configTable returns the keys and values in the table called name.
+func configTable(name string) map[string]string {
+	table := make(map[string]string)
+	for k, v := range config {
+		if strings.HasPrefix(k, name+".") {
+			table[k[len(name)+1:]] = v
+		}
+	}
+	return table
+}
+
+// configFloat returns the number stored under key, or def if there is none.
+func configFloat(key string, def float64) (float64, error) {
+	v, ok := config[key]
+	if !ok {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf(tr("config: %s is not a number: %q"), key, v)
+	}
+	return f, nil
+}
+
+// configDuration returns the duration stored under key, or 0 if there is
+// none.
+func configDuration(key string) (time.Duration, error) {
+	v, ok := config[key]
+	if !ok {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf(tr("config: %s is not a duration: %q"), key, v)
+	}
+	return d, nil
+}
+
+// parseConfig parses the subset of TOML that makes up the configuration:
+// comments, tables, and keys with string, number, and boolean values. The
+// values are stored in conf by their full key. Errors are prefixed with the
+// line number they occur on.
+func parseConfig(r io.Reader, conf map[string]string) error {
+	var table string
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		if line[0] == '[' {
+			i := strings.LastIndex(line, "]")
+			if i < 0 || !isComment(line[i+1:]) {
+				return fmt.Errorf(tr("%d: invalid table header"), n)
+			}
+			key, rest, err := parseKey(line[1:i])
+			if err != nil || strings.TrimSpace(rest) != "" {
+				return fmt.Errorf(tr("%d: invalid table name"), n)
+			}
+			table = key
+			continue
+		}
+
+		key, rest, err := parseKey(line)
+		if err != nil {
+			return fmt.Errorf("%d: %v", n, err)
+		}
+		rest = strings.TrimSpace(rest)
+		if rest == "" || rest[0] != '=' {
+			return fmt.Errorf(tr("%d: expected = after %s"), n, key)
+		}
+		value, rest, err := parseValue(strings.TrimSpace(rest[1:]))
+		if err != nil {
+			return fmt.Errorf("%d: %v", n, err)
+		}
+		if !isComment(rest) {
+			return fmt.Errorf(tr("%d: unexpected %q after value"), n, strings.TrimSpace(rest))
+		}
+
+		if table != "" {
+			key = table + "." + key
+		}
+		conf[key] = value
+	}
+	return scanner.Err()
+}
+
+// isComment returns true if s is empty apart from white space and a comment.
+func isComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s[0] == '#'
+}
+
+// parseKey parses a dotted key, whose parts may be quoted, from the
+// beginning of s and returns the rest of s.
+func parseKey(s string) (key, rest string, err error) {
+	var parts []string
+	for {
+		s = strings.TrimSpace(s)
+		var part string
+		if s != "" && (s[0] == '"' || s[0] == '\'') {
+			part, s, err = parseString(s)
+			if err != nil {
+				return
+			}
+		} else {
+			i := strings.IndexFunc(s, func(r rune) bool {
+				return !(r == '_' || r == '-' || '0' <= r && r <= '9' ||
+					'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z')
+			})
+			if i < 0 {
+				i = len(s)
+			}
+			if i == 0 {
+				return "", "", fmt.Errorf(tr("invalid key %q"), s)
+			}
+			part, s = s[:i], s[i:]
+		}
+		parts = append(parts, part)
+
+		s = strings.TrimSpace(s)
+		if s == "" || s[0] != '.' {
+			return strings.Join(parts, "."), s, nil
+		}
+		s = s[1:]
+	}
+}
+
+// parseValue parses a value from the beginning of s and returns the rest.
+// Strings are unquoted; other values are returned as they are written.
+func parseValue(s string) (value, rest string, err error) {
+	if s == "" {
+		return "", "", errors.New(tr("missing value"))
+	}
+	if s[0] == '"' || s[0] == '\'' {
+		return parseString(s)
+	}
+	i := strings.IndexAny(s, " \t#")
+	if i < 0 {
+		i = len(s)
+	}
+	return s[:i], s[i:], nil
+}
+
+// parseString parses a basic "string" or a literal 'string' from the
+// beginning of s and returns the rest.
+func parseString(s string) (value, rest string, err error) {
+	if s[0] == '\'' {
+		i := strings.IndexByte(s[1:], '\'')
+		if i < 0 {
+			return "", "", errors.New(tr("unterminated string"))
+		}
+		return s[1 : i+1], s[i+2:], nil
+	}
+
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			i++
+			if i == len(s) {
+				break
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\':
+				b.WriteByte(s[i])
+			default:
+				return "", "", fmt.Errorf(tr("invalid escape \\%c in string"), s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", "", errors.New(tr("unterminated string"))
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// For begins a new entry for the duration given as argument, such as 90m,
+// and counts down the time that is left. When the time is up, the terminal
+// bell rings, the alarm command from the configuration is run, and the
+// entry is completed. For example,
+//
+//	alarm = "notify-send track 'Time is up'"
+//
+// shows a notification on Linux. If track is terminated before the time
+// is up, the entry is completed right away. Otherwise the entry is waited
+// for like with run, see waitFrom.
+func For() error {
+	d, err := time.ParseDuration(cmdArgs[0])
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return fmt.Errorf(tr("%s is not a positive duration"), cmdArgs[0])
+	}
+	alarm, err := splitArgs(config["alarm"])
+	if err != nil {
+		return fmt.Errorf("config: alarm: %v", err)
+	}
+
+	start := time.Now()
+	if err = beginAt(start); err != nil {
+		return err
+	}
+	return waitFrom(start, start.Add(d), &countdown{alarm: alarm})
+}
+
+// A countdown shows the time that is left while waiting for a deadline,
+// and sounds an alarm when it has come. The methods do nothing on a nil
+// countdown, so that waitFrom can call them whether it counts down or not.
+type countdown struct {
+	alarm []string // the command that is run when the time is up
+}
+
+// show shows the time that is left at now until deadline.
+func (cd *countdown) show(now, deadline time.Time) {
+	if cd == nil || quietFlag {
+		return
+	}
+	left := deadline.Sub(now)
+	if left < 0 {
+		left = 0
+	}
+	fmt.Printf("\r%s %s ", tr("left:"), formatDuration(left.Round(time.Second)))
+}
+
+// stop ends the line that the time left is shown on.
+func (cd *countdown) stop() {
+	if cd != nil && !quietFlag {
+		fmt.Println()
+	}
+}
+
+// ring rings the terminal bell and runs the alarm command, since the time is
+// up.
+func (cd *countdown) ring() {
+	if cd == nil {
+		return
+	}
+	fmt.Print("\a")
+	cd.stop()
+	if len(cd.alarm) > 0 {
+		cmd := exec.Command(cd.alarm[0], cd.alarm[1:]...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			warn("alarm: %v", err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// delimiter separates the fields of a record in the times file.
+var delimiter = ','
+
+// newReader returns a CSV reader for the times file in r.
+func newReader(r io.Reader) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	return reader
+}
+
+// newWriter returns a CSV writer for the times file in w.
+func newWriter(w io.Writer) *csv.Writer {
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+	return writer
+}
+
+// parseDelimiter parses the name of a delimiter, which is either the
+// character itself or "tab".
+func parseDelimiter(s string) (rune, error) {
+	if s == "tab" || s == `\t` {
+		return '\t', nil
+	}
+	r, n := utf8.DecodeRuneInString(s)
+	if n == 0 || n != len(s) || r == '"' || r == '#' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf(tr("invalid delimiter %q"), s)
+	}
+	return r, nil
+}
+
+// setDelimiter sets the delimiter for the times file at path, which is given
+// by the -delimiter option, or else by the key delimiter in the
+// configuration. Otherwise it is detected from the first record in the file,
+// or if that does not tell, a file ending in .tsv uses tabs and any other
+// file uses commas.
+func setDelimiter(path string) (err error) {
+	if delimiterFlag != "" {
+		delimiter, err = parseDelimiter(delimiterFlag)
+		return
+	}
+	if s, ok := config["delimiter"]; ok {
+		delimiter, err = parseDelimiter(s)
+		if err != nil {
+			err = fmt.Errorf("config: %v", err)
+		}
+		return
+	}
+
+	// All the files that a pattern stands for are taken to be like the
+	// first.
+	if paths, err := expandPaths(path); err == nil {
+		path = paths[0]
+	}
+	if r, ok := detectDelimiter(path); ok {
+		delimiter = r
+	} else if strings.EqualFold(filepath.Ext(path), ".tsv") {
+		delimiter = '\t'
+	} else {
+		delimiter = ','
+	}
+	return nil
+}
+
+// detectDelimiter returns the delimiter used by the first record in the file
+// at path. Since the first field is usually a time, which contains none of
+// the delimiters, the first delimiter on that line is taken to be the one.
+// Standard input is only peeked at, since it cannot be read again, so the
+// record has to be in the first few kilobytes.
+func detectDelimiter(path string) (rune, bool) {
+	var r io.Reader
+	if path == stdio {
+		data, _ := stdin.Peek(stdin.Size())
+		r = bytes.NewReader(data)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return 0, false
+		}
+		defer f.Close()
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if i := strings.IndexAny(line, ",;\t|"); i >= 0 {
+			return rune(line[i]), true
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// columnNames are the names of the columns in the configuration, in the
+// order of the standard layout of a record.
+var columnNames = [numColumns]string{"begin", "end", "tags", "note"}
+
+// columns gives the field in which each column of the standard layout is
+// found in the times file, or -1 if the file does not have the column. It is
+// nil if the times file uses the standard layout. width is the number of
+// fields that records have in the file.
+var (
+	columns []int
+	width   int
+)
+
+// setColumns sets the layout of the records in the times file from the key
+// columns in the configuration, which lists the names of the fields in the
+// order they appear in the file, such as "tags,begin,end,hours". Fields
+// other than begin, end, tags, and note are ignored, and left empty in new
+// records.
+func setColumns() (err error) {
+	columns, width = nil, 0
+	if s, ok := config["columns"]; ok {
+		columns, width, err = parseColumns(s)
+		if err != nil {
+			err = fmt.Errorf("config: %v", err)
+		}
+	}
+	return
+}
+
+// parseColumns parses a comma-separated list of field names into the field
+// of each column and the number of fields.
+func parseColumns(s string) (layout []int, n int, err error) {
+	layout = []int{-1, -1, -1, -1}
+	fields := strings.Split(s, ",")
+	for i, name := range fields {
+		name = strings.TrimSpace(name)
+		for col, c := range columnNames {
+			if name != c {
+				continue
+			}
+			if layout[col] >= 0 {
+				return nil, 0, fmt.Errorf(tr("column %s is given twice"), name)
+			}
+			layout[col] = i
+		}
+	}
+	if layout[colBegin] < 0 {
+		return nil, 0, errors.New(tr("columns do not contain begin"))
+	}
+	return layout, len(fields), nil
+}
+
+// fromFile returns record, as it is read from the times file, in the
+// standard layout.
+func fromFile(record []string) []string {
+	if columns == nil {
+		return record
+	}
+	return pick(columns, record)
+}
+
+// pick returns the fields of record that layout gives for each column, in
+// the standard layout. Empty fields at the end of the result are left out.
+func pick(layout []int, record []string) []string {
+	std := make([]string, numColumns)
+	for col, i := range layout {
+		if i >= 0 && i < len(record) {
+			std[col] = strings.TrimSpace(record[i])
+		}
+	}
+	n := len(std)
+	for n > 1 && std[n-1] == "" {
+		n--
+	}
+	return std[:n]
+}
+
+// toFile returns record, which is in the standard layout, as it is written
+// to the times file. The fields that track does not use are taken from
+// fields, the record as it was read from the file, if there is one.
+func toFile(record, fields []string) []string {
+	if columns == nil {
+		return record
+	}
+	out := make([]string, width)
+	copy(out, fields)
+	for col, i := range columns {
+		if i >= 0 && col < len(record) {
+			out[i] = record[col]
+		}
+	}
+	return out
+}
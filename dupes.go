@@ -0,0 +1,122 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// A duplicate is an entry that repeats an earlier entry in the times file,
+// either exactly or by beginning within a short time of it.
+type duplicate struct {
+	Orig, Dup *Entry
+}
+
+// Exact returns true if the duplicate is identical to the original.
+func (d *duplicate) Exact() bool {
+	return d.Orig.Begin.Equal(d.Dup.Begin) && d.Orig.End.Equal(d.Dup.End)
+}
+
+func (d *duplicate) String() string {
+	if d.Exact() {
+		return fmt.Sprintf(tr("line %d duplicates line %d"), d.Dup.Line, d.Orig.Line)
+	}
+	diff := d.Dup.Begin.Sub(d.Orig.Begin)
+	if diff < 0 {
+		diff = -diff
+	}
+	return fmt.Sprintf(tr("line %d nearly duplicates line %d (begins %s apart)"), d.Dup.Line, d.Orig.Line, diff)
+}
+
+// findDuplicates returns the entries that begin within the given time of
+// an entry that occurs earlier in the file. Each entry is reported at most
+// once, and the earliest entry of a group of duplicates is the original.
+func findDuplicates(entries []Entry, within time.Duration) []duplicate {
+	sorted := make([]*Entry, len(entries))
+	for i := range entries {
+		sorted[i] = &entries[i]
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Begin.Before(sorted[j].Begin)
+	})
+
+	var dupes []duplicate
+	seen := make(map[*Entry]bool)
+	for i, a := range sorted {
+		if seen[a] {
+			continue
+		}
+		for _, b := range sorted[i+1:] {
+			if b.Begin.Sub(a.Begin) > within {
+				break
+			}
+			if seen[b] {
+				continue
+			}
+			seen[b] = true
+			d := duplicate{Orig: a, Dup: b}
+			if b.Line < a.Line {
+				d.Orig, d.Dup = b, a
+			}
+			dupes = append(dupes, d)
+		}
+	}
+	sort.Slice(dupes, func(i, j int) bool { return dupes[i].Dup.Line < dupes[j].Dup.Line })
+	return dupes
+}
+
+// Dupes reports the entries that duplicate other entries, and removes them
+// from the times file if the -remove option is given.
+func Dupes() error {
+	entries, err := loadTimes(pathArg)
+	if err != nil {
+		return err
+	}
+
+	dupes := findDuplicates(entries, withinFlag)
+	for i := range dupes {
+		fmt.Println(dupes[i].String())
+	}
+	if !removeFlag || len(dupes) == 0 {
+		return nil
+	}
+
+	remove := make(map[int]bool, len(dupes))
+	for _, d := range dupes {
+		remove[d.Dup.Line] = true
+	}
+	f, err := os.Open(pathArg)
+	if err != nil {
+		return err
+	}
+	blocks, err := readBlocks(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	kept := make([]block, 0, len(blocks))
+	var comments []string
+	for _, b := range blocks {
+		if b.record != nil && remove[b.line] {
+			// Comments on a removed entry belong to whatever comes next.
+			comments = append(comments, b.comments...)
+			continue
+		}
+		b.comments = append(comments, b.comments...)
+		comments = nil
+		kept = append(kept, b)
+	}
+	if comments != nil {
+		kept = append(kept, block{comments: comments})
+	}
+	if err = writeBlocks(pathArg, kept); err != nil {
+		return err
+	}
+	inform(fmt.Sprintf(tr("REMOVED %d"), len(dupes)))
+	return nil
+}
@@ -0,0 +1,418 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// The columns of a record in the times file. Only the beginning is required;
+// an entry without an end is one that has begun but not been completed.
+const (
+	colBegin = iota
+	colEnd
+	colTags
+	colNote
+	numColumns
+)
+
+// complete returns true if record is a completed entry.
+func complete(record []string) bool {
+	return len(record) >= 2 && len(record) <= numColumns && record[colEnd] != ""
+}
+
+// begun returns true if record is an entry that has begun but not been
+// completed yet.
+func begun(record []string) bool {
+	return len(record) <= numColumns && record[colBegin] != "" &&
+		(len(record) == 1 || record[colEnd] == "")
+}
+
+// billableTag is the reserved tag that marks entries as billable.
+const billableTag = "billable"
+
+// An Entry is a time entry from the times file. An entry that has begun
+// but not been completed yet has a zero End.
+type Entry struct {
+	Begin time.Time
+	End   time.Time
+	Tags  []string
+	Note  string
+
+	// Line is the line in the times file that the entry was read from,
+	// or 0 if the entry was not read from a file.
+	Line int
+
+	// File is the times file that the entry was read from when entries are
+	// read from several files at once, and "" otherwise.
+	File string
+
+	// ID is the position of the entry among the records in the times file,
+	// counting from 1, or 0 if the entry was not read from a file.
+	ID int
+
+	// Comments are the comment lines that precede the entry in the file.
+	Comments []string
+
+	// Fields is the record that the entry was read from as it appears in
+	// the file, which keeps the fields that track does not use.
+	Fields []string
+}
+
+// Duration returns the time that was spent in the entry.
+func (e *Entry) Duration() time.Duration {
+	return e.End.Sub(e.Begin)
+}
+
+// HasTag returns true if the entry is tagged with tag, or with a tag that
+// lies below tag in the hierarchy, such as tag:project.
+func (e *Entry) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag || strings.HasPrefix(t, tag+tagSep) {
+			return true
+		}
+	}
+	return false
+}
+
+// Record returns the entry as it is stored in the times file.
+func (e *Entry) Record() []string {
+	record := []string{e.Begin.Format(timeFormat), ""}
+	if !e.End.IsZero() {
+		record[colEnd] = e.End.Format(timeFormat)
+	}
+	switch {
+	case e.Note != "":
+		record = append(record, strings.Join(e.Tags, " "), e.Note)
+	case len(e.Tags) > 0:
+		record = append(record, strings.Join(e.Tags, " "))
+	case e.End.IsZero():
+		record = record[:1]
+	}
+	return record
+}
+
+func (e *Entry) String() string {
+	s := fmt.Sprintf("%s to %s (%s)", e.Begin.Format(timeFormat), e.End.Format(timeFormat), e.Duration())
+	if len(e.Tags) > 0 {
+		s += " " + strings.Join(e.Tags, " ")
+	}
+	if e.Note != "" {
+		s += fmt.Sprintf(" %q", e.Note)
+	}
+	return s
+}
+
+// parseEntry parses a complete or begun record from the times file.
+func parseEntry(record []string, line int) (e Entry, err error) {
+	err = e.parse(record, line)
+	return
+}
+
+// parse sets e to the complete or begun record from the times file.
+func (e *Entry) parse(record []string, line int) (err error) {
+	*e = Entry{Line: line}
+	e.Begin, err = time.Parse(timeFormat, record[colBegin])
+	if err != nil {
+		return
+	}
+	if len(record) > colEnd && record[colEnd] != "" {
+		e.End, err = time.Parse(timeFormat, record[colEnd])
+	}
+	if len(record) > colTags {
+		e.Tags = strings.Fields(record[colTags])
+	}
+	if len(record) > colNote {
+		e.Note = record[colNote]
+	}
+	return
+}
+
+// Billable returns true if the time spent in the entry can be charged.
+func (e *Entry) Billable() bool {
+	return e.HasTag(billableTag)
+}
+
+// newEntry returns an entry that begins at t, with the tags and note given
+// by the -tag, -billable, and -note options.
+func newEntry(t time.Time) *Entry {
+	e := &Entry{Begin: t, Tags: append([]string(nil), tagFlag...), Note: noteFlag}
+	if billableFlag && !e.Billable() {
+		e.Tags = append(e.Tags, billableTag)
+	}
+	return e
+}
+
+// loadTimes reads the complete entries from the times file at path.
+//
+// Invalid entries are reported as a warning, unless the -fail option is
+// given, in which case they are an error.
+func loadTimes(path string) ([]Entry, error) {
+	var entries []Entry
+	err := scanFile(path, func(e *Entry) bool {
+		entries = append(entries, *e)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// scanFile is like scanTimes for the times file at path, except that invalid
+// entries are handled like loadTimes does. Since the entries are not kept,
+// commands that only look at each entry once can read files of any size.
+func scanFile(path string, fn func(e *Entry) bool) error {
+	return checkFormat(scanPath(path, fn), "")
+}
+
+// scanPath calls fn with each complete entry in the times file at path in
+// turn, until fn returns false, and returns the error of scanTimes.
+func scanPath(path string, fn func(e *Entry) bool) error {
+	f, err := openTimes(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return scanTimes(f, fn)
+}
+
+// checkFormat handles err from reading a times file: a *FormatError is only
+// a warning, unless -fail is given and more than the last entry is
+// incomplete. The warning or error names the file if name is not "".
+func checkFormat(err error, name string) error {
+	ferr, ok := err.(*FormatError)
+	if !ok {
+		return err
+	}
+	if !ferr.JustIncomplete() && failFlag {
+		if name != "" {
+			return fmt.Errorf("%s: %w", name, ferr)
+		}
+		return err
+	}
+	if name != "" {
+		warn("%s: %s", name, ferr)
+	} else {
+		warn("%s", ferr)
+	}
+	return nil
+}
+
+// readTimes reads the complete entries from r.
+//
+// Incomplete and invalid records are left out and reported by a
+// *FormatError, which is returned along with the entries that could be read.
+func readTimes(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	err := scanTimes(r, func(e *Entry) bool {
+		entries = append(entries, *e)
+		return true
+	})
+	if _, ok := err.(*FormatError); err != nil && !ok {
+		return nil, err
+	}
+	return entries, err
+}
+
+// scanTimes calls fn with each complete entry in r in turn, until fn returns
+// false. The entry is only valid during the call, since its memory is used
+// again for the next entry, and so are the buffers that records are read
+// into. Incomplete and invalid records are skipped and reported by a
+// *FormatError once all of r has been read.
+func scanTimes(r io.Reader, fn func(e *Entry) bool) error {
+	if recoverFlag {
+		return recoverTimes(r, fn)
+	}
+	reader := newReader(r)
+	reader.ReuseRecord = true
+
+	var (
+		e         Entry
+		formatErr FormatError
+	)
+	for id := 1; ; id++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		record = fromFile(record)
+
+		line, _ := reader.FieldPos(0)
+		if !complete(record) {
+			formatErr.LastIsBad = true
+			formatErr.BadLines = append(formatErr.BadLines, line)
+			continue
+		}
+		formatErr.LastIsBad = false
+		if err = e.parse(record, line); err != nil {
+			return &LineError{line, err}
+		}
+		e.ID = id
+		if !fn(&e) {
+			return nil
+		}
+	}
+	if formatErr.BadLines != nil {
+		return &formatErr
+	}
+	return nil
+}
+
+// lastRecord returns the last record in data, along with the offsets at
+// which it begins and ends. If there is no record, then record is nil.
+func lastRecord(data []byte) (record []string, begin, end int64, err error) {
+	reader := newReader(bytes.NewReader(data))
+	for {
+		off := reader.InputOffset()
+		r, err := reader.Read()
+		if err == io.EOF {
+			return record, begin, end, nil
+		} else if err != nil {
+			return nil, 0, 0, err
+		}
+
+		// The record is preceded by any comment or empty lines that the
+		// reader skipped over.
+		record, begin, end = fromFile(r), off, reader.InputOffset()
+		for begin < end && (data[begin] == '#' || data[begin] == '\n' || data[begin] == '\r') {
+			i := bytes.IndexByte(data[begin:end], '\n')
+			if i < 0 {
+				break
+			}
+			begin += int64(i) + 1
+		}
+	}
+}
+
+// byBegin sorts entries chronologically by their beginning, and entries
+// that begin at the same time by their end.
+type byBegin []Entry
+
+func (s byBegin) Len() int      { return len(s) }
+func (s byBegin) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byBegin) Less(i, j int) bool {
+	if s[i].Begin.Equal(s[j].Begin) {
+		return s[i].End.Before(s[j].End)
+	}
+	return s[i].Begin.Before(s[j].Begin)
+}
+
+// A block is a record from the times file together with the comment lines
+// that directly precede it. The record is in the standard layout, while
+// fields holds it as it was read from the file.
+type block struct {
+	comments []string
+	record   []string
+	fields   []string
+	line     int
+}
+
+// readBlocks reads all the records and comment lines from r. Comment lines
+// that follow the last record are returned in a final block without a record.
+//
+// Unlike readEntries, readBlocks does not check the records in any way.
+func readBlocks(r io.Reader) ([]block, error) {
+	var (
+		blocks []block
+		cur    block
+		text   strings.Builder
+		quoted bool
+	)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if !quoted {
+			if strings.HasPrefix(line, "#") {
+				cur.comments = append(cur.comments, line)
+				continue
+			}
+			if line == "" {
+				continue
+			}
+		}
+
+		if text.Len() == 0 {
+			cur.line = n
+		} else {
+			text.WriteByte('\n')
+		}
+		text.WriteString(line)
+		if strings.Count(line, `"`)%2 == 1 {
+			quoted = !quoted
+		}
+		if quoted {
+			continue
+		}
+
+		reader := newReader(strings.NewReader(text.String()))
+		record, err := reader.Read()
+		if err != nil {
+			return nil, &LineError{cur.line, err}
+		}
+		cur.record, cur.fields = fromFile(record), record
+		blocks = append(blocks, cur)
+		cur = block{}
+		text.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if quoted {
+		return nil, &LineError{cur.line, errors.New(tr("unterminated quoted field"))}
+	}
+	if cur.comments != nil {
+		blocks = append(blocks, cur)
+	}
+	return blocks, nil
+}
+
+// writeBlocks replaces the contents of the file at path with blocks.
+//
+// The blocks are first written to a temporary file which then replaces
+// the original, so that the times are not lost if anything goes wrong.
+func writeBlocks(path string, blocks []block) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	writer := newWriter(w)
+	for _, b := range blocks {
+		writer.Flush()
+		for _, c := range b.comments {
+			w.WriteString(c)
+			w.WriteByte('\n')
+		}
+		if b.record != nil {
+			writer.Write(toFile(b.record, b.fields))
+		}
+	}
+	writer.Flush()
+	if err = writer.Error(); err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
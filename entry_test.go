@@ -0,0 +1,153 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// benchSizes are the numbers of lines of the times files that the
+// benchmarks read. The time per line and the memory per operation should
+// stay about the same as the files grow, since entries are streamed.
+var benchSizes = []int{1e4, 1e5, 1e6}
+
+// benchFiles caches the generated times files by their number of lines.
+var benchFiles = make(map[int]string)
+
+// benchTimes returns the path of a times file with n complete entries.
+func benchTimes(b *testing.B, n int) string {
+	if path, ok := benchFiles[n]; ok {
+		return path
+	}
+	dir, err := os.MkdirTemp("", "track-bench-")
+	if err != nil {
+		b.Fatal(err)
+	}
+	path := filepath.Join(dir, "TIMES.csv")
+	f, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	t := time.Date(2020, time.January, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < n; i++ {
+		end := t.Add(45 * time.Minute)
+		fmt.Fprintf(w, "%s,%s,client%d:project billable,note %d\n", t.Format(timeFormat),
+			end.Format(timeFormat), i%7, i)
+		t = end.Add(15 * time.Minute)
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchFiles[n] = path
+	return path
+}
+
+// TestMain removes the files that the benchmarks generated.
+func TestMain(m *testing.M) {
+	code := m.Run()
+	for _, path := range benchFiles {
+		os.RemoveAll(filepath.Dir(path))
+	}
+	os.Exit(code)
+}
+
+// benchEach runs fn as a benchmark for each of benchSizes, with pathArg set
+// to a times file of that size. Besides the allocations, it reports the
+// time per line and the largest heap while fn ran, which should not grow
+// with the size of the file.
+func benchEach(b *testing.B, fn func(b *testing.B, path string)) {
+	for _, n := range benchSizes {
+		path := benchTimes(b, n)
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			pathArg, pathArgs = path, nil
+			runtime.GC()
+			stop := make(chan struct{})
+			peak := make(chan uint64)
+			go sampleHeap(stop, peak)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				fn(b, path)
+			}
+			b.StopTimer()
+			close(stop)
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/float64(n), "ns/line")
+			b.ReportMetric(float64(<-peak), "peak-heap-B")
+		})
+	}
+}
+
+// sampleHeap reads the size of the heap every millisecond until stop is
+// closed, and then sends the largest size to peak.
+func sampleHeap(stop <-chan struct{}, peak chan<- uint64) {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	var max uint64
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+	for {
+		metrics.Read(sample)
+		if v := sample[0].Value.Uint64(); v > max {
+			max = v
+		}
+		select {
+		case <-stop:
+			peak <- max
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// discardStdout sends what fn prints to standard output to the null device.
+func discardStdout(b *testing.B, fn func() error) {
+	null, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer null.Close()
+	stdout := os.Stdout
+	os.Stdout = null
+	defer func() { os.Stdout = stdout }()
+	if err = fn(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkScanTimes(b *testing.B) {
+	benchEach(b, func(b *testing.B, path string) {
+		var n int
+		err := scanPath(path, func(e *Entry) bool {
+			n++
+			return true
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	})
+}
+
+func BenchmarkList(b *testing.B) {
+	benchEach(b, func(b *testing.B, path string) {
+		discardStdout(b, List)
+	})
+}
+
+func BenchmarkTotal(b *testing.B) {
+	benchEach(b, func(b *testing.B, path string) {
+		discardStdout(b, Total)
+	})
+}
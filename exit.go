@@ -0,0 +1,181 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// The codes that track exits with, which scripts such as pre-commit hooks
+// can rely on to tell the problems with the times file apart. When verify
+// finds several kinds of problems, it exits with the highest code of them.
+const (
+	exitOK         = 0 // there were no problems
+	exitFailure    = 1 // any error that has no code of its own
+	exitUsage      = 2 // the command line is invalid
+	exitIncomplete = 3 // the last entry is incomplete, with -strict
+	exitMalformed  = 4 // some entries are incomplete or invalid
+	exitOverlap    = 5 // some entries overlap each other, with -strict
+	exitDuplicate  = 6 // some entries duplicate other entries
+)
+
+// A codedError is an error that track exits with a specific code for.
+type codedError struct {
+	code  int
+	err   error
+	lines []int       // the lines of the times file with the problems
+	files []errorFile // the problems in each of several times files
+}
+
+func (e *codedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *codedError) Unwrap() error {
+	return e.err
+}
+
+// exitCode returns the code that track exits with after err, which is not
+// nil. A *FormatError, as returned with -fail, has the code for invalid
+// entries, and so do the errors for a times file that cannot be parsed.
+// Only verify with -strict exits with the code for an incomplete last
+// entry, since -fail lets the last entry be incomplete.
+func exitCode(err error) int {
+	var (
+		cerr *codedError
+		perr *csv.ParseError
+		lerr *LineError
+		ferr *FormatError
+	)
+	if errors.As(err, &cerr) {
+		return cerr.code
+	}
+	if errors.As(err, &perr) || errors.As(err, &lerr) {
+		return exitMalformed
+	}
+	if errors.As(err, &ferr) {
+		if ferr.JustIncomplete() {
+			return exitIncomplete
+		}
+		return exitMalformed
+	}
+	return exitFailure
+}
+
+// errorKinds names the kind of problem of each exit code in the documents
+// that -json writes errors as.
+var errorKinds = map[int]string{
+	exitFailure:    "error",
+	exitUsage:      "usage",
+	exitIncomplete: "incomplete",
+	exitMalformed:  "malformed",
+	exitOverlap:    "overlap",
+	exitDuplicate:  "duplicate",
+}
+
+// errorFixes suggests how to fix each kind of problem.
+var errorFixes = map[int]string{
+	exitUsage:      "see track -help for the commands and options",
+	exitIncomplete: "complete the last entry with track end",
+	exitMalformed:  "correct or remove the lines, or read the file with -recover",
+	exitOverlap:    "resolve the overlaps with track clean",
+	exitDuplicate:  "remove the duplicates with track dupes -remove",
+}
+
+// An errorDocument describes an error for other programs, such as wrappers
+// and graphical front ends, when the -json option is given.
+type errorDocument struct {
+	Code    int    `json:"code"`
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	File    string `json:"file,omitempty"`
+	Lines   []int  `json:"lines,omitempty"`
+	Fix     string `json:"fix,omitempty"`
+
+	// Files has the lines with problems in each file, when several times
+	// files were read, instead of File and Lines.
+	Files []errorFile `json:"files,omitempty"`
+}
+
+// An errorFile has the lines of one of several times files that an error
+// is about.
+type errorFile struct {
+	File  string `json:"file"`
+	Lines []int  `json:"lines"`
+}
+
+// fail reports err on standard error, as an errorDocument with the -json
+// option, and exits with its code.
+func fail(err error) {
+	code := exitCode(err)
+	if jsonFlag {
+		writeErrorDocument(os.Stderr, code, err)
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", tr("Error"), err)
+	}
+	os.Exit(code)
+}
+
+// usage reports that the command line is invalid, because of err, and exits.
+// Without -json, the usage text is printed instead of err.
+func usage(err error) {
+	if jsonFlag {
+		fail(&codedError{code: exitUsage, err: err})
+	}
+	Help()
+	os.Exit(exitUsage)
+}
+
+// writeErrorDocument writes err, which track exits with code for, to w as
+// an errorDocument.
+func writeErrorDocument(w io.Writer, code int, err error) {
+	doc := errorDocument{
+		Code:    code,
+		Kind:    errorKinds[code],
+		Message: err.Error(),
+		Lines:   errorLines(err),
+	}
+	if cerr := (*codedError)(nil); errors.As(err, &cerr) {
+		doc.Files = cerr.files
+	}
+	if fix, ok := errorFixes[code]; ok {
+		doc.Fix = tr(fix)
+	}
+	if code == exitMalformed && recoverFlag {
+		doc.Fix = tr("correct or remove the lines")
+	}
+	if paths, _ := filePaths(); code >= exitIncomplete && len(paths) == 1 {
+		doc.File = paths[0]
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(map[string]errorDocument{"error": doc})
+}
+
+// errorLines returns the lines of the times file that err is about.
+func errorLines(err error) []int {
+	var (
+		cerr *codedError
+		lerr *LineError
+		perr *csv.ParseError
+		ferr *FormatError
+	)
+	switch {
+	case errors.As(err, &cerr) && cerr.lines != nil:
+		return cerr.lines
+	case errors.As(err, &lerr):
+		return []int{lerr.Line}
+	case errors.As(err, &perr):
+		return []int{perr.StartLine}
+	case errors.As(err, &ferr):
+		return ferr.BadLines
+	}
+	return nil
+}
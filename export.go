@@ -0,0 +1,275 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// An exporter writes entries in one of the formats of export. Write is
+// called with each entry to export in turn, and Close once after the last
+// one, so an exporter can write a header before the first entry and a
+// footer in Close. The entry is only valid during the call to Write.
+//
+// To add a format, write a function that makes an exporter that writes to
+// an io.Writer, and register it in exporters.
+type exporter interface {
+	Write(e *Entry) error
+	Close() error
+}
+
+// exporters makes an exporter to w for each format that export writes.
+var exporters = map[string]func(w io.Writer) exporter{
+	"csv":        func(w io.Writer) exporter { return newTableExporter(w, ',') },
+	"freshbooks": newFreshBooksExporter,
+	"html":       newHTMLExporter,
+	"ics":        newICSExporter,
+	"json":       newJSONExporter,
+	"markdown":   newMarkdownExporter,
+	"org":        newOrgExporter,
+	"otlp":       newOTLPExporter,
+	"quickbooks": newQuickBooksExporter,
+	"timeclock":  newTimeclockExporter,
+	"tsv":        func(w io.Writer) exporter { return newTableExporter(w, '\t') },
+}
+
+// exportFormats returns the names of the formats that export writes.
+func exportFormats() []string {
+	names := make([]string, 0, len(exporters))
+	for name := range exporters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Export writes the entries that match the filter options to standard output
+// in the format given by the -format option, which is one of:
+//
+//	csv, tsv    one row for each entry, with a header
+//	json        an array with an object for each entry
+//	ics         an iCalendar file with an event for each entry
+//	timeclock   the timeclock format of ledger and hledger
+//	org         an Org heading with a clock line for each entry
+//	markdown    a table in Markdown
+//	html        a page with a table
+//	quickbooks  the CSV layout that QuickBooks imports time entries from
+//	freshbooks  the CSV layout that FreshBooks imports time entries from
+//	otlp        OpenTelemetry spans, which are sent to a collector
+//
+// With the -slot option or the configuration, all the entries are snapped to
+// a grid of slots first, and then filtered; see loadSlots and snap.
+func Export() error {
+	newExporter, ok := exporters[formatFlag]
+	if !ok {
+		formats := strings.Join(exportFormats(), ", ")
+		if formatFlag == "" {
+			return fmt.Errorf(tr("no export format given with -format; the formats are %s"), formats)
+		}
+		return fmt.Errorf(tr("unknown export format %q; the formats are %s"), formatFlag, formats)
+	}
+	match, err := entryFilter()
+	if err != nil {
+		return err
+	}
+	grid, err := loadSlots()
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	x := newExporter(out)
+	var werr error
+	var entries []Entry
+	err = scanFile(pathArg, func(e *Entry) bool {
+		if grid != nil {
+			entries = append(entries, *e)
+			return true
+		}
+		if !match(e) {
+			return true
+		}
+		werr = x.Write(e)
+		return werr == nil
+	})
+	if grid != nil && err == nil {
+		for _, e := range grid.snap(entries) {
+			if !match(&e) {
+				continue
+			}
+			if werr = x.Write(&e); werr != nil {
+				break
+			}
+		}
+	}
+	if err == nil {
+		err = werr
+	}
+	if cerr := x.Close(); err == nil {
+		err = cerr
+	}
+	if ferr := out.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// A csvExporter writes each entry as a row of a CSV file with a header.
+type csvExporter struct {
+	w      *csv.Writer
+	header []string
+	row    func(e *Entry) []string
+}
+
+func (x *csvExporter) Write(e *Entry) error {
+	if x.header != nil {
+		x.w.Write(x.header)
+		x.header = nil
+	}
+	return x.w.Write(x.row(e))
+}
+
+func (x *csvExporter) Close() error {
+	if x.header != nil {
+		x.w.Write(x.header)
+	}
+	x.w.Flush()
+	return x.w.Error()
+}
+
+// newTableExporter returns an exporter of the entries as rows of fields
+// separated by comma.
+func newTableExporter(w io.Writer, comma rune) exporter {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	return &csvExporter{cw, []string{"begin", "end", "hours", "tags", "note"}, func(e *Entry) []string {
+		return []string{e.Begin.Format(time.RFC3339), e.End.Format(time.RFC3339), formatHours(e.Duration()),
+			strings.Join(e.Tags, " "), e.Note}
+	}}
+}
+
+// formatHours formats d as a decimal number of hours.
+func formatHours(d time.Duration) string {
+	return fmt.Sprintf("%.2f", d.Hours())
+}
+
+// newQuickBooksExporter returns an exporter of the entries in the layout of
+// QuickBooks.
+func newQuickBooksExporter(w io.Writer) exporter {
+	employee := config["accounting.employee"]
+	header := []string{"Date", "Employee", "Customer", "Service Item", "Start Time", "End Time",
+		"Duration", "Billable", "Description"}
+	return newAccountingExporter(w, header, func(e *Entry, customer, service string) []string {
+		billable := "No"
+		if e.Billable() {
+			billable = "Yes"
+		}
+		d := e.Duration().Round(time.Minute)
+		return []string{e.Begin.Format("01/02/2006"), employee, customer, service,
+			e.Begin.Format("03:04 PM"), e.End.Format("03:04 PM"),
+			fmt.Sprintf("%d:%02d", int(d.Hours()), int(d.Minutes())%60), billable, e.Note}
+	})
+}
+
+// newFreshBooksExporter returns an exporter of the entries in the layout of
+// FreshBooks.
+func newFreshBooksExporter(w io.Writer) exporter {
+	employee := config["accounting.employee"]
+	header := []string{"Date", "Team Member", "Client", "Project", "Service", "Notes", "Hours"}
+	return newAccountingExporter(w, header, func(e *Entry, customer, service string) []string {
+		return []string{e.Begin.Format(dateFormat), employee, customer, projectOf(e), service,
+			e.Note, formatHours(e.Duration())}
+	})
+}
+
+// newAccountingExporter returns an exporter of the entries as rows for an
+// accounting program, which row makes from an entry with its customer and
+// service.
+//
+// The customer and service of an entry are looked up by its most specific
+// tag in the [customers] and [services] tables of the configuration, and
+// otherwise default to the top level of the first tag and the rest of it.
+// The employee is the key employee in [accounting]:
+//
+//	[accounting]
+//	employee = "Jane Doe"
+//
+//	[customers]
+//	clientA = "Acme Corporation"
+//
+//	[services]
+//	"clientA:web" = "Web Development"
+func newAccountingExporter(w io.Writer, header []string,
+	row func(e *Entry, customer, service string) []string) exporter {
+	customers, services := configTable("customers"), configTable("services")
+	return &csvExporter{csv.NewWriter(w), header, func(e *Entry) []string {
+		customer := lookupTag(e, customers)
+		if customer == "" {
+			customer = tagLevel(e, 0, 1)
+		}
+		service := lookupTag(e, services)
+		if service == "" {
+			service = tagLevel(e, 1, -1)
+		}
+		return row(e, customer, service)
+	}}
+}
+
+// lookupTag returns the value in table for the most specific tag of e, or ""
+// if there is none.
+func lookupTag(e *Entry, table map[string]string) string {
+	return table[specificTag(e, func(t string) bool {
+		_, ok := table[t]
+		return ok
+	})]
+}
+
+// tagLevel returns the levels from i up to j of the first tag of e that is
+// not reserved, or all levels from i if j is negative.
+func tagLevel(e *Entry, i, j int) string {
+	for _, t := range e.Tags {
+		if t == billableTag {
+			continue
+		}
+		parts := strings.Split(t, tagSep)
+		if j < 0 || j > len(parts) {
+			j = len(parts)
+		}
+		if i >= j {
+			return ""
+		}
+		return strings.Join(parts[i:j], tagSep)
+	}
+	return ""
+}
+
+// projectOf returns the project of e, which is the second level of its tag.
+func projectOf(e *Entry) string {
+	return tagLevel(e, 1, 2)
+}
+
+// nameOf returns the name of e in formats that give each entry a title,
+// which is its most specific tag that is not reserved.
+func nameOf(e *Entry) string {
+	name := specificTag(e, func(t string) bool { return t != billableTag })
+	if name == "" {
+		name = untagged
+	}
+	return name
+}
+
+// entryDigest returns a hash of e, which identifies it in formats that need
+// an ID for each entry, so that exporting an entry again gives the same ID.
+func entryDigest(e *Entry) [sha256.Size]byte {
+	return sha256.Sum256([]byte(strings.Join(e.Record(), "\x00")))
+}
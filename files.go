@@ -0,0 +1,252 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxReaders is the largest number of times files that are read at the same
+// time. Reading several files at once hides the latency of network file
+// systems, where most of the time is spent waiting for the server.
+const maxReaders = 8
+
+// expandPaths returns the times files that path stands for. A path with the
+// characters *, ?, or [ is a pattern as understood by filepath.Match, which
+// stands for the files that match it in order. The pattern is expanded by
+// track rather than the shell, so it has to be quoted, and works the same on
+// Windows. Any other path stands for itself.
+func expandPaths(path string) ([]string, error) {
+	if !strings.ContainsAny(path, "*?[") {
+		return []string{path}, nil
+	}
+	paths, err := filepath.Glob(path)
+	if err != nil {
+		return nil, fmt.Errorf(tr("bad pattern %q: %v"), path, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf(tr("no files match %s"), path)
+	}
+	return paths, nil
+}
+
+// filePaths returns the times files that are read by the commands that
+// can read several at once: the files that the paths given on the command
+// line stand for, or else the times file. A file that several paths stand
+// for is only read once. Standard input can only be read once, so it cannot
+// be given along with other files.
+func filePaths() ([]string, error) {
+	args := pathArgs
+	if args == nil {
+		args = []string{pathArg}
+	}
+	for _, arg := range args {
+		if arg == stdio && len(args) > 1 {
+			return nil, fmt.Errorf(tr("standard input (%s) cannot be read along with other times files"), stdio)
+		}
+	}
+	var paths []string
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		ps, err := expandPaths(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range ps {
+			if !seen[p] {
+				seen[p] = true
+				paths = append(paths, p)
+			}
+		}
+	}
+	return paths, nil
+}
+
+// scanFiles calls fn with the index in paths of each times file and each of
+// its complete entries in turn, until fn returns false for that file, like
+// scanFile does for a single file. If there are several files, the File of
+// each entry is set.
+//
+// Up to maxReaders files are read concurrently, so fn may be called for
+// different files at the same time, but never for the same file. To get the
+// same results every time, fn should aggregate each file on its own, and the
+// caller should merge the aggregates in the order of paths. Warnings about
+// the files are given in that order too, once all of them have been read.
+func scanFiles(paths []string, fn func(i int, e *Entry) bool) error {
+	if len(paths) == 1 {
+		return scanFile(paths[0], func(e *Entry) bool { return fn(0, e) })
+	}
+
+	errs := make([]error, len(paths))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < maxReaders && w < len(paths); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				errs[i] = scanPath(paths[i], func(e *Entry) bool {
+					e.File = paths[i]
+					return fn(i, e)
+				})
+			}
+		}()
+	}
+	for i := range paths {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err = checkFormat(err, paths[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeFiles calls fn with the complete entries of the times files at paths
+// in chronological order, until fn returns false. Entries that begin at the
+// same time are in the order of paths, and the File of each entry is set.
+//
+// The files are read at the same time and merged as they are read, so that
+// only the next entry of each file is held in memory. A file whose entries
+// are not in chronological order is read in full and sorted first. Warnings
+// about the files are given in the order of paths once the merge is done.
+func mergeFiles(paths []string, fn func(e *Entry) bool) error {
+	done := make(chan struct{})
+	scanners := make([]*fileScanner, len(paths))
+	var h mergeHeap
+	for i, path := range paths {
+		scanners[i] = scanSorted(path, done)
+	}
+	for i, s := range scanners {
+		if e, ok := <-s.entries; ok {
+			h = append(h, mergeHead{e, i})
+		}
+	}
+	heap.Init(&h)
+	for h.Len() > 0 {
+		head := &h[0]
+		if !fn(&head.entry) {
+			break
+		}
+		if e, ok := <-scanners[head.file].entries; ok {
+			head.entry = e
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	close(done)
+
+	for i, s := range scanners {
+		for range s.entries {
+		}
+		if err := checkFormat(s.err, paths[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A fileScanner reads the entries of a times file in chronological order
+// for mergeFiles.
+type fileScanner struct {
+	entries chan Entry
+	err     error // the error of reading the file, once entries is closed
+}
+
+// scanSorted starts to send the complete entries of the times file at path
+// in chronological order, until done is closed. The file is read once to
+// find out whether its entries are in order, and then again to send them,
+// so that only the files that are not in order have to be held in memory.
+func scanSorted(path string, done <-chan struct{}) *fileScanner {
+	s := &fileScanner{entries: make(chan Entry, 64)}
+	send := func(e *Entry) bool {
+		e.File = path
+		select {
+		case s.entries <- *e:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	go func() {
+		defer close(s.entries)
+		sorted := true
+		var last time.Time
+		s.err = scanPath(path, func(e *Entry) bool {
+			sorted = !e.Begin.Before(last)
+			last = e.Begin
+			return sorted
+		})
+		if _, ok := s.err.(*FormatError); s.err != nil && !ok {
+			return
+		}
+		if sorted {
+			// The file was read in full, so this gives the same warnings,
+			// even when the merge stops early.
+			if err := scanPath(path, send); err != nil {
+				if _, ok := err.(*FormatError); !ok {
+					s.err = err
+				}
+			}
+			return
+		}
+		var entries []Entry
+		s.err = scanPath(path, func(e *Entry) bool {
+			entries = append(entries, *e)
+			return true
+		})
+		if _, ok := s.err.(*FormatError); s.err != nil && !ok {
+			return
+		}
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Begin.Before(entries[j].Begin) })
+		for i := range entries {
+			if !send(&entries[i]) {
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// A mergeHead is the next entry of one of the files that are merged.
+type mergeHead struct {
+	entry Entry
+	file  int // the index of the file in the paths
+}
+
+// A mergeHeap holds the next entry of each file that is merged, with the
+// earliest at the top.
+type mergeHeap []mergeHead
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	if !h[i].entry.Begin.Equal(h[j].entry.Begin) {
+		return h[i].entry.Begin.Before(h[j].entry.Begin)
+	}
+	return h[i].file < h[j].file
+}
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeHead)) }
+
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
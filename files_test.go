@@ -0,0 +1,25 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFilePathsStdio(t *testing.T) {
+	defer func(path string, paths []string) { pathArg, pathArgs = path, paths }(pathArg, pathArgs)
+
+	pathArg, pathArgs = stdio, nil
+	if paths, err := filePaths(); err != nil || !reflect.DeepEqual(paths, []string{stdio}) {
+		t.Errorf("filePaths() for %s alone = %v, %v, want [%s]", stdio, paths, err, stdio)
+	}
+	for _, args := range [][]string{{stdio, "other.csv"}, {"other.csv", stdio}, {stdio, stdio}} {
+		pathArg, pathArgs = args[0], args
+		if paths, err := filePaths(); err == nil {
+			t.Errorf("filePaths() for %q = %v, want an error", args, paths)
+		}
+	}
+}
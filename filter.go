@@ -0,0 +1,82 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// tagList is a list of tags that can be given as an option several times,
+// or as a single comma-separated list.
+type tagList []string
+
+func (l *tagList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *tagList) Set(s string) error {
+	*l = append(*l, strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})...)
+	return nil
+}
+
+const dateFormat = "2006-01-02"
+
+// entryFilter returns a function that returns true for the entries that are
+// selected by the -from, -to, -tag, -exclude-tag, -billable, and
+// -min-duration options.
+//
+// An entry is selected if it has any of the tags given by -tag and none of
+// the tags given by -exclude-tag. An entry that has begun but not been
+// completed has no duration yet, so -min-duration does not apply to it.
+func entryFilter() (func(*Entry) bool, error) {
+	var from, to time.Time
+	var err error
+	if fromFlag != "" {
+		from, err = time.ParseInLocation(dateFormat, fromFlag, time.Local)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if toFlag != "" {
+		to, err = time.ParseInLocation(dateFormat, toFlag, time.Local)
+		if err != nil {
+			return nil, err
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+
+	return func(e *Entry) bool {
+		if !from.IsZero() && e.Begin.Before(from) {
+			return false
+		}
+		if !to.IsZero() && !e.Begin.Before(to) {
+			return false
+		}
+		if minDurationFlag > 0 && !e.End.IsZero() && e.Duration() < minDurationFlag {
+			return false
+		}
+		if billableFlag && !e.Billable() {
+			return false
+		}
+		for _, t := range excludeFlag {
+			if e.HasTag(t) {
+				return false
+			}
+		}
+		if len(tagFlag) == 0 {
+			return true
+		}
+		for _, t := range tagFlag {
+			if e.HasTag(t) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
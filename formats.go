@@ -0,0 +1,320 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// This file has the exporters of the formats that are not CSV layouts.
+
+// A jsonExporter writes the entries as an array of objects.
+type jsonExporter struct {
+	w io.Writer
+	n int
+}
+
+// A jsonEntry is an entry as exported to JSON.
+type jsonEntry struct {
+	Begin    string   `json:"begin"`
+	End      string   `json:"end"`
+	Hours    float64  `json:"hours"`
+	Tags     []string `json:"tags"`
+	Note     string   `json:"note,omitempty"`
+	Billable bool     `json:"billable"`
+}
+
+func newJSONExporter(w io.Writer) exporter {
+	return &jsonExporter{w: w}
+}
+
+func (x *jsonExporter) Write(e *Entry) error {
+	tags := e.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	data, err := json.Marshal(jsonEntry{e.Begin.Format(time.RFC3339), e.End.Format(time.RFC3339),
+		e.Duration().Hours(), tags, e.Note, e.Billable()})
+	if err != nil {
+		return err
+	}
+	sep := ",\n  "
+	if x.n == 0 {
+		sep = "[\n  "
+	}
+	x.n++
+	_, err = fmt.Fprintf(x.w, "%s%s", sep, data)
+	return err
+}
+
+func (x *jsonExporter) Close() error {
+	end := "\n]\n"
+	if x.n == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(x.w, end)
+	return err
+}
+
+// An icsExporter writes the entries as the events of an iCalendar file, as
+// described by RFC 5545. Each event is named after the most specific tag of
+// the entry, and has its tags as categories and its note as description.
+type icsExporter struct {
+	w       io.Writer
+	started bool
+}
+
+// icsTime is the format of the times in an iCalendar file, in UTC.
+const icsTime = "20060102T150405Z"
+
+func newICSExporter(w io.Writer) exporter {
+	return &icsExporter{w: w}
+}
+
+func (x *icsExporter) start() {
+	if !x.started {
+		x.started = true
+		x.line("BEGIN:VCALENDAR")
+		x.line("VERSION:2.0")
+		x.line("PRODID:-//track//EN")
+	}
+}
+
+func (x *icsExporter) Write(e *Entry) error {
+	x.start()
+	id := entryDigest(e)
+	x.line("BEGIN:VEVENT")
+	x.line("UID:" + hex.EncodeToString(id[:16]) + "@track")
+	// The time stamp is the beginning rather than the time of the export,
+	// so that exporting the same entries gives the same file.
+	x.line("DTSTAMP:" + e.Begin.UTC().Format(icsTime))
+	x.line("DTSTART:" + e.Begin.UTC().Format(icsTime))
+	x.line("DTEND:" + e.End.UTC().Format(icsTime))
+	x.line("SUMMARY:" + icsText(nameOf(e)))
+	if len(e.Tags) > 0 {
+		tags := make([]string, len(e.Tags))
+		for i, t := range e.Tags {
+			tags[i] = icsText(t)
+		}
+		x.line("CATEGORIES:" + strings.Join(tags, ","))
+	}
+	if e.Note != "" {
+		x.line("DESCRIPTION:" + icsText(e.Note))
+	}
+	return x.line("END:VEVENT")
+}
+
+func (x *icsExporter) Close() error {
+	x.start()
+	return x.line("END:VCALENDAR")
+}
+
+// line writes a content line, folded so that no line is longer than 75
+// octets.
+func (x *icsExporter) line(s string) error {
+	const max = 75
+	var b strings.Builder
+	for n := max; len(s) > n; n = max - 1 {
+		i := n
+		for i > 0 && !utf8.RuneStart(s[i]) {
+			i--
+		}
+		b.WriteString(s[:i])
+		b.WriteString("\r\n ")
+		s = s[i:]
+	}
+	b.WriteString(s)
+	b.WriteString("\r\n")
+	_, err := io.WriteString(x.w, b.String())
+	return err
+}
+
+// icsText escapes s as a text value of iCalendar.
+var icsText = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace
+
+// A timeclockExporter writes the entries in the timeclock format that
+// ledger and hledger read, with the most specific tag of each entry as the
+// account and its note as the description.
+type timeclockExporter struct {
+	w io.Writer
+}
+
+// timeclockTime is the format of the times in a timeclock file.
+const timeclockTime = "2006/01/02 15:04:05"
+
+func newTimeclockExporter(w io.Writer) exporter {
+	return &timeclockExporter{w}
+}
+
+func (x *timeclockExporter) Write(e *Entry) error {
+	// Parentheses around an account make it virtual in ledger.
+	account := strings.Trim(nameOf(e), "()")
+	in := fmt.Sprintf("i %s %s", e.Begin.Local().Format(timeclockTime), account)
+	if e.Note != "" {
+		in += "  " + strings.ReplaceAll(e.Note, "\n", " ")
+	}
+	_, err := fmt.Fprintf(x.w, "%s\no %s\n", in, e.End.Local().Format(timeclockTime))
+	return err
+}
+
+func (x *timeclockExporter) Close() error {
+	return nil
+}
+
+// An orgExporter writes the entries as headings of Org mode, with a clock
+// line for each entry in its logbook and its note as the body.
+type orgExporter struct {
+	w io.Writer
+}
+
+// orgTime is the format of the timestamps in clock lines.
+const orgTime = "[2006-01-02 Mon 15:04]"
+
+func newOrgExporter(w io.Writer) exporter {
+	return &orgExporter{w}
+}
+
+func (x *orgExporter) Write(e *Entry) error {
+	d := e.Duration().Round(time.Minute)
+	var b strings.Builder
+	fmt.Fprintf(&b, "* %s\n", nameOf(e))
+	b.WriteString("  :LOGBOOK:\n")
+	fmt.Fprintf(&b, "  CLOCK: %s--%s => %2d:%02d\n", e.Begin.Local().Format(orgTime),
+		e.End.Local().Format(orgTime), int(d.Hours()), int(d.Minutes())%60)
+	b.WriteString("  :END:\n")
+	for _, line := range strings.Split(e.Note, "\n") {
+		if line != "" {
+			fmt.Fprintf(&b, "  %s\n", line)
+		}
+	}
+	_, err := io.WriteString(x.w, b.String())
+	return err
+}
+
+func (x *orgExporter) Close() error {
+	return nil
+}
+
+// The headers of the tables that the markdown and html formats write.
+var exportHeaders = []string{"begin", "end", "duration", "tags", "note"}
+
+// exportCells returns the cells of e in a table of the markdown or html
+// format.
+func exportCells(e *Entry) []string {
+	const cellTime = "2006-01-02 15:04"
+	return []string{e.Begin.Local().Format(cellTime), e.End.Local().Format(cellTime),
+		formatDuration(e.Duration()), strings.Join(e.Tags, " "), e.Note}
+}
+
+// A markdownExporter writes the entries as a table in Markdown, which ends
+// with the total duration.
+type markdownExporter struct {
+	w       io.Writer
+	started bool
+	sum     time.Duration
+}
+
+func newMarkdownExporter(w io.Writer) exporter {
+	return &markdownExporter{w: w}
+}
+
+func (x *markdownExporter) start() error {
+	if x.started {
+		return nil
+	}
+	x.started = true
+	header := make([]string, len(exportHeaders))
+	for i, h := range exportHeaders {
+		header[i] = tr(h)
+	}
+	return x.row(header, "| --- | --- | ---: | --- | --- |\n")
+}
+
+func (x *markdownExporter) Write(e *Entry) error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	x.sum += e.Duration()
+	return x.row(exportCells(e), "")
+}
+
+func (x *markdownExporter) Close() error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	return x.row([]string{"**" + tr("total") + "**", "", "**" + formatDuration(x.sum) + "**", "", ""}, "")
+}
+
+// row writes a row with cells, followed by after.
+func (x *markdownExporter) row(cells []string, after string) error {
+	escaped := make([]string, len(cells))
+	for i, c := range cells {
+		escaped[i] = markdownCell(c)
+	}
+	_, err := fmt.Fprintf(x.w, "| %s |\n%s", strings.Join(escaped, " | "), after)
+	return err
+}
+
+// markdownCell escapes s for a cell of a table in Markdown.
+var markdownCell = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>").Replace
+
+// An htmlExporter writes a page with the entries in a table, which ends with
+// the total duration.
+type htmlExporter struct {
+	w       io.Writer
+	started bool
+	sum     time.Duration
+}
+
+func newHTMLExporter(w io.Writer) exporter {
+	return &htmlExporter{w: w}
+}
+
+func (x *htmlExporter) start() error {
+	if x.started {
+		return nil
+	}
+	x.started = true
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>track</title>\n</head>\n")
+	b.WriteString("<body>\n<table>\n<thead>\n<tr>")
+	for _, h := range exportHeaders {
+		fmt.Fprintf(&b, "<th>%s</th>", html.EscapeString(tr(h)))
+	}
+	b.WriteString("</tr>\n</thead>\n<tbody>\n")
+	_, err := io.WriteString(x.w, b.String())
+	return err
+}
+
+func (x *htmlExporter) Write(e *Entry) error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	x.sum += e.Duration()
+	var b strings.Builder
+	b.WriteString("<tr>")
+	for _, c := range exportCells(e) {
+		fmt.Fprintf(&b, "<td>%s</td>", strings.ReplaceAll(html.EscapeString(c), "\n", "<br>"))
+	}
+	b.WriteString("</tr>\n")
+	_, err := io.WriteString(x.w, b.String())
+	return err
+}
+
+func (x *htmlExporter) Close() error {
+	if err := x.start(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(x.w, "</tbody>\n<tfoot>\n<tr><th colspan=\"2\">%s</th><td>%s</td><td colspan=\"2\"></td></tr>\n"+
+		"</tfoot>\n</table>\n</body>\n</html>\n", html.EscapeString(tr("total")), html.EscapeString(formatDuration(x.sum)))
+	return err
+}
@@ -0,0 +1,287 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importLayouts are the time formats that import tries, in order, if the
+// -time-format option is not given.
+var importLayouts = []string{
+	timeFormat,
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"01/02/2006 15:04:05",
+	"01/02/2006 15:04",
+}
+
+// previewSize is the number of entries that import shows before merging.
+const previewSize = 5
+
+// Import merges the entries from the file given as argument, which was
+// written by another program, into the times file. The only -format that
+// can be imported is csv.
+//
+// The -columns option gives the names of the fields in the file, as for the
+// key columns in the configuration, and the -time-format option gives the
+// format of its times as a Go layout, such as "02.01.2006 15:04". Without
+// -columns, the user is asked which field holds what, and without
+// -time-format, the format is detected. A first record whose beginning is
+// not a time is taken to be a header. Times without a time zone are in
+// local time.
+//
+// Before anything is merged, the entries are previewed along with any
+// problems found, and the user is asked to confirm. Entries that are
+// already in the times file are left out.
+func Import() error {
+	if formatFlag != "" && formatFlag != "csv" {
+		return fmt.Errorf(tr("cannot import format %q"), formatFlag)
+	}
+	records, lines, err := readForeign(cmdArgs[0])
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf(tr("%s: no records to import"), cmdArgs[0])
+	}
+
+	var layout []int
+	if columnsFlag != "" {
+		layout, _, err = parseColumns(columnsFlag)
+	} else {
+		layout, err = askColumns(records[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	format := timeFormatFlag
+	if format == "" {
+		format = detectLayout(records, layout)
+		if format == "" && columnsFlag == "" {
+			format, err = ask("Time format, as a Go layout such as 2006-01-02 15:04: ")
+		}
+		if err != nil {
+			return err
+		}
+		if format == "" {
+			return errors.New(tr("unknown time format: use -time-format"))
+		}
+	}
+
+	var (
+		imported []Entry
+		problems []string
+	)
+	for i, r := range records {
+		e, err := importEntry(pick(layout, r), format)
+		if err != nil {
+			if i == 0 {
+				continue // a header
+			}
+			problems = append(problems, fmt.Sprintf("line %d: %v", lines[i], err))
+			continue
+		}
+		imported = append(imported, e)
+	}
+
+	entries, tail, err := loadEntries(pathArg)
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	imported, dupes := withoutExisting(imported, entries)
+
+	fmt.Printf(tr("Importing %d entries from %s"), len(imported), cmdArgs[0])
+	if dupes > 0 {
+		fmt.Printf(tr(", leaving out %d already in %s"), dupes, pathArg)
+	}
+	fmt.Println(":")
+	for i := range imported {
+		if i == previewSize {
+			fmt.Printf("   ...  "+tr("and %d more")+"\n", len(imported)-i)
+			break
+		}
+		imported[i].ID = i + 1
+		printEntry(&imported[i])
+	}
+	for _, p := range problems {
+		warn("%s", p)
+	}
+	if len(problems) > 0 && failFlag {
+		return fmt.Errorf(tr("found %d problems in %s"), len(problems), cmdArgs[0])
+	}
+	if len(imported) == 0 {
+		return nil
+	}
+
+	answer, err := ask(fmt.Sprintf(tr("Merge %d entries into %s? [y/n] "), len(imported), pathArg))
+	if err != nil {
+		return err
+	}
+	if answer != tr("y") {
+		return errors.New(tr("nothing imported"))
+	}
+	for i := range imported {
+		imported[i].ID = 0
+	}
+	entries = append(entries, imported...)
+	sort.Stable(byBegin(entries))
+	if err = saveEntries(pathArg, entries, tail); err != nil {
+		return err
+	}
+	inform(fmt.Sprintf(tr("IMPORTED %d"), len(imported)))
+	return nil
+}
+
+// readForeign reads all the records from the CSV file at path, whose
+// delimiter is detected, along with the line that each of them is on.
+func readForeign(path string) (records [][]string, lines []int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	if r, ok := detectDelimiter(path); ok {
+		reader.Comma = r
+	}
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return records, lines, nil
+		} else if err != nil {
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record)
+		lines = append(lines, line)
+	}
+}
+
+// askColumns shows the fields of first, the first record of the file to be
+// imported, and asks the user which of them holds each column.
+func askColumns(first []string) ([]int, error) {
+	fmt.Println(tr("The first record has the fields:"))
+	for i, s := range first {
+		fmt.Printf("%4d  %s\n", i+1, s)
+	}
+
+	prompts := [numColumns]string{
+		"Field with the beginning (1-%d): ",
+		"Field with the end (1-%d): ",
+		"Field with the tags (1-%d, empty if none): ",
+		"Field with the note (1-%d, empty if none): ",
+	}
+	layout := []int{-1, -1, -1, -1}
+	for col, prompt := range prompts {
+		for {
+			answer, err := ask(fmt.Sprintf(tr(prompt), len(first)))
+			if err != nil {
+				return nil, err
+			}
+			if answer == "" && col != colBegin {
+				break
+			}
+			n, err := strconv.Atoi(answer)
+			if err == nil && n >= 1 && n <= len(first) {
+				layout[col] = n - 1
+				break
+			}
+		}
+	}
+	return layout, nil
+}
+
+// ask prints prompt and returns the line that the user answers with.
+func ask(prompt string) (string, error) {
+	fmt.Print(prompt)
+	answer, err := stdin.ReadString('\n')
+	if err != nil {
+		return "", errors.New(tr("no answer given"))
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// detectLayout returns the first of importLayouts in which the beginning of
+// the most records can be parsed, or "" if there is none.
+func detectLayout(records [][]string, layout []int) string {
+	var best string
+	var most int
+	for _, format := range importLayouts {
+		var n int
+		for _, r := range records {
+			if _, err := time.ParseInLocation(format, pick(layout, r)[colBegin], time.Local); err == nil {
+				n++
+			}
+		}
+		if n > most {
+			best, most = format, n
+		}
+	}
+	return best
+}
+
+// importEntry parses a record in the standard layout whose times are in
+// the given format. The entry must be complete.
+func importEntry(record []string, format string) (e Entry, err error) {
+	if len(record) <= colEnd || record[colEnd] == "" {
+		return e, errors.New(tr("entry has no end"))
+	}
+	e.Begin, err = time.ParseInLocation(format, record[colBegin], time.Local)
+	if err != nil {
+		return
+	}
+	e.End, err = time.ParseInLocation(format, record[colEnd], time.Local)
+	if err != nil {
+		return
+	}
+	if e.End.Before(e.Begin) {
+		return e, errors.New(tr("entry ends before it begins"))
+	}
+	if len(record) > colTags {
+		e.Tags = strings.Fields(record[colTags])
+	}
+	if len(record) > colNote {
+		e.Note = record[colNote]
+	}
+	return
+}
+
+// withoutExisting returns the entries in imported that do not begin and end
+// at the same time as any of the entries in existing, and how many did.
+func withoutExisting(imported, existing []Entry) (kept []Entry, n int) {
+	seen := make(map[[2]int64]bool)
+	for _, e := range existing {
+		seen[[2]int64{e.Begin.Unix(), e.End.Unix()}] = true
+	}
+	for _, e := range imported {
+		if seen[[2]int64{e.Begin.Unix(), e.End.Unix()}] {
+			n++
+			continue
+		}
+		kept = append(kept, e)
+	}
+	return kept, n
+}
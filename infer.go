@@ -0,0 +1,108 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// inferTag returns the tag for entries that are begun without one, as it is
+// derived from the current directory or its git repository, or "" if the
+// configuration does not ask for it:
+//
+//	infer-tag = "git" # or "dir"
+//
+//	[tag-rules]
+//	'github\.com[:/]acme/([^/]+?)(\.git)?$' = "acme:$1"
+//	'^/home/me/src/([^/]+)' = "$1"
+//
+// With "dir", the path of the current directory is used, and with "git",
+// the URL of the origin remote of the repository, falling back to the
+// directory outside of a repository. The rules are regular expressions that
+// are matched against the path or URL, with the longest pattern tried first;
+// the tag of the first matching rule is expanded with the submatches. If no
+// rule matches, the tag is the name of the directory or repository.
+func inferTag() (string, error) {
+	source, ok := config["infer-tag"]
+	if !ok {
+		return "", nil
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	s, name := dir, filepath.Base(dir)
+	switch source {
+	case "dir":
+	case "git":
+		out, err := exec.Command("git", "config", "--get", "remote.origin.url").Output()
+		if url := strings.TrimSpace(string(out)); err == nil && url != "" {
+			s = url
+			name = strings.TrimSuffix(path.Base(strings.Replace(url, ":", "/", -1)), ".git")
+		}
+	default:
+		return "", fmt.Errorf(tr("config: infer-tag must be dir or git, not %q"), source)
+	}
+
+	rules := configTable("tag-rules")
+	patterns := make([]string, 0, len(rules))
+	for p := range rules {
+		patterns = append(patterns, p)
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		if len(patterns[i]) != len(patterns[j]) {
+			return len(patterns[i]) > len(patterns[j])
+		}
+		return patterns[i] < patterns[j]
+	})
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return "", fmt.Errorf("config: tag-rules: %v", err)
+		}
+		if m := re.FindStringSubmatchIndex(s); m != nil {
+			name = string(re.ExpandString(nil, rules[p], s, m))
+			break
+		}
+	}
+
+	// Tags are separated by white space and commas, so they cannot contain
+	// either of them.
+	return strings.Map(func(r rune) rune {
+		if r == ',' || unicode.IsSpace(r) {
+			return '-'
+		}
+		return r
+	}, name), nil
+}
+
+// withDefaultTag gives e the default tag if no tags are given with the -tag
+// option. The default tag is given by the key tag in the configuration,
+// usually that of a project, or else it is inferred.
+func withDefaultTag(e *Entry) (*Entry, error) {
+	if len(tagFlag) > 0 {
+		return e, nil
+	}
+	tag, ok := config["tag"]
+	if ok {
+		e.Tags = append(strings.Fields(tag), e.Tags...)
+		return e, nil
+	}
+	tag, err := inferTag()
+	if err != nil || tag == "" {
+		return e, err
+	}
+	e.Tags = append([]string{tag}, e.Tags...)
+	return e, nil
+}
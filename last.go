@@ -0,0 +1,131 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Last prints the most recent entry in the times file, which is the last one
+// in the file, whether it is complete or not.
+//
+// The -begin and -end options change the entry before it is printed. They
+// can either shift the time by a duration, such as +15m or -1h, or set it to
+// a time of the same day, such as 17:30, or to a complete time. Giving an end
+// to a begun entry completes it. Moving the beginning before the end of the
+// previous entry is a warning, or an error with -fail.
+func Last() error {
+	f, err := os.OpenFile(pathArg, os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	record, at, _, err := lastRecord(data)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return errors.New(tr("there are no entries"))
+	}
+	if !complete(record) && !begun(record) {
+		return errors.New(tr("the last entry is invalid"))
+	}
+	e, err := parseEntry(record, 0)
+	if err != nil {
+		return err
+	}
+
+	if beginFlag != "" || endFlag != "" {
+		now := time.Now()
+		if beginFlag != "" {
+			if e.Begin, err = adjustTime(beginFlag, e.Begin); err != nil {
+				return err
+			}
+		}
+		if endFlag != "" {
+			base := e.End
+			if base.IsZero() {
+				base = now.In(e.Begin.Location()).Truncate(time.Second)
+			}
+			if e.End, err = adjustTime(endFlag, base); err != nil {
+				return err
+			}
+		}
+		if !e.End.IsZero() && e.End.Before(e.Begin) {
+			return errors.New(tr("the entry would end before it begins"))
+		}
+		if e.Begin.After(now) || e.End.After(now) {
+			return errors.New(tr("the entry would lie in the future"))
+		}
+		if beginFlag != "" {
+			if err := checkPrevious(data[:at], e.Begin); err != nil {
+				if failFlag {
+					return err
+				}
+				warn("%v", err)
+			}
+		}
+		if err = replaceLast(f, e.Record()); err != nil {
+			return err
+		}
+	}
+
+	if e.End.IsZero() {
+		line := fmt.Sprintf("%s  %-23s  %*s  %s", e.Begin.Format(timeFormat), "running",
+			durationWidth(), formatDuration(time.Since(e.Begin).Round(time.Second)), strings.Join(e.Tags, " "))
+		if e.Note != "" {
+			line += "  " + e.Note
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	} else {
+		printEntry(&e)
+	}
+	return nil
+}
+
+// checkPrevious returns an error if begin lies before the end of the last
+// complete entry in data, so that the changed entry would overlap it.
+func checkPrevious(data []byte, begin time.Time) error {
+	record, _, _, err := lastRecord(data)
+	if err != nil || record == nil || !complete(record) {
+		return nil
+	}
+	prev, err := parseEntry(record, 0)
+	if err != nil || !begin.Before(prev.End) {
+		return nil
+	}
+	return fmt.Errorf(tr("the entry would begin before the previous one ends at %s"),
+		prev.End.Format(timeFormat))
+}
+
+// adjustTime returns t changed according to s, which is either a signed
+// duration, a time of day in the form 15:04 or 15:04:05, or a complete time.
+func adjustTime(s string, t time.Time) (time.Time, error) {
+	if s[0] == '+' || s[0] == '-' {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return t, err
+		}
+		return t.Add(d), nil
+	}
+
+	for _, layout := range []string{"15:04", "15:04:05"} {
+		if c, err := time.ParseInLocation(layout, s, t.Location()); err == nil {
+			y, m, d := t.Date()
+			return time.Date(y, m, d, c.Hour(), c.Minute(), c.Second(), 0, t.Location()), nil
+		}
+	}
+	return time.Parse(timeFormat, s)
+}
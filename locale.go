@@ -0,0 +1,93 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// A timeLocale describes how durations and dates are written for people in
+// a locale.
+type timeLocale struct {
+	hour, minute, second string // the units of durations
+	date                 string // the layout of dates
+}
+
+// timeLocales are the locales in which durations and dates are written in
+// words. In any other locale, they are written as Go writes them, such as
+// 2h30m0s and 2024-05-01.
+var timeLocales = map[string]timeLocale{
+	"de": {"Std.", "Min.", "Sek.", "02.01.2006"},
+	"es": {"h", "min", "s", "02/01/2006"},
+	"fr": {"h", "min", "s", "02/01/2006"},
+	"it": {"h", "min", "s", "02/01/2006"},
+	"nl": {"uur", "min.", "sec.", "02-01-2006"},
+	"pt": {"h", "min", "s", "02/01/2006"},
+	"sv": {"tim", "min", "s", "2006-01-02"},
+}
+
+// humanLocale is the locale used by the formatters for people, or nil if
+// durations and dates are written as Go writes them.
+var humanLocale *timeLocale
+
+// setHumanLocale sets humanLocale from the -locale option or the key locale
+// in the configuration. The environment is not used, so that the output of
+// scripts that read it does not change with the language of the user.
+func setHumanLocale() {
+	humanLocale = nil
+	name := localeName()
+	if name == "" {
+		return
+	}
+	for _, k := range localeKeys(name) {
+		if tl, ok := timeLocales[k]; ok {
+			humanLocale = &tl
+			return
+		}
+	}
+}
+
+// formatDuration formats d for people, such as "2 Std. 30 Min." in German.
+// Seconds are only written if there are any.
+func formatDuration(d time.Duration) string {
+	if humanLocale == nil {
+		return d.String()
+	}
+	var sign string
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	d = d.Round(time.Second)
+	h, m, s := int(d/time.Hour), int(d%time.Hour/time.Minute), int(d%time.Minute/time.Second)
+
+	var parts []string
+	if h > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", h, humanLocale.hour))
+	}
+	if m > 0 || h == 0 && s == 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", m, humanLocale.minute))
+	}
+	if s > 0 {
+		parts = append(parts, fmt.Sprintf("%d %s", s, humanLocale.second))
+	}
+	return sign + strings.Join(parts, " ")
+}
+
+// durationWidth returns the width of a column of durations of less than a
+// hundred hours, as written by formatDuration.
+func durationWidth() int {
+	return utf8.RuneCountInString(formatDuration(-(99*time.Hour + 59*time.Minute + 59*time.Second))) - 1
+}
+
+// formatDate formats the date of t for people.
+func formatDate(t time.Time) string {
+	if humanLocale == nil {
+		return t.Format(dateFormat)
+	}
+	return t.Format(humanLocale.date)
+}
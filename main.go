@@ -10,7 +10,6 @@ package main
 
 import (
 	"bytes"
-	"encoding/csv"
 	"errors"
 	"flag"
 	"fmt"
@@ -18,12 +17,20 @@ import (
 	"os"
 	"os/exec"
 	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
 	"time"
+	"unicode/utf8"
 )
 
 type FormatError struct {
 	BadLines  []int
 	LastIsBad bool
+
+	// Reasons describes why each of the BadLines was skipped, when the times
+	// file was read with -recover.
+	Reasons map[int]string
 }
 
 func (e *FormatError) JustIncomplete() bool {
@@ -31,154 +38,614 @@ func (e *FormatError) JustIncomplete() bool {
 }
 
 func (e *FormatError) Error() string {
+	if len(e.Reasons) > 0 {
+		msg := fmt.Sprintf(tr("skipped %d damaged lines"), len(e.Reasons))
+		for _, line := range e.BadLines {
+			if reason, ok := e.Reasons[line]; ok {
+				msg += fmt.Sprintf("\n\t"+tr("line %d: %s"), line, reason)
+			}
+		}
+		return msg
+	}
 	if e.JustIncomplete() {
-		return "last entry is incomplete"
+		return tr("last entry is incomplete")
 	} else {
 		if len(e.BadLines) == 1 {
-			return fmt.Sprint("incomplete or invalid entry on line ", e.BadLines[0])
+			return fmt.Sprintf(tr("incomplete or invalid entry on line %d"), e.BadLines[0])
 		} else {
-			return fmt.Sprint("incomplete or invalid entries on lines ", spokenList(e.BadLines))
+			return fmt.Sprintf(tr("incomplete or invalid entries on lines %s"), spokenList(e.BadLines))
 		}
 	}
 }
 
+// A LineError is an error in the entry on a line of the times file.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf(tr("line %d: %v"), e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
 var which = map[string]func() error{
-	"begin":  Begin,
-	"end":    End,
-	"fork":   Fork,
-	"list":   List,
-	"next":   Next,
-	"run":    Run,
-	"status": Status,
-	"total":  Total,
-	"verify": Verify,
-	"wait":   Wait,
+	"annotate":    Annotate,
+	"begin":       Begin,
+	"clean":       Clean,
+	"dupes":       Dupes,
+	"end":         End,
+	"export":      Export,
+	"for":         For,
+	"fork":        Fork,
+	"import":      Import,
+	"last":        Last,
+	"list":        List,
+	"next":        Next,
+	"pause":       Pause,
+	"report":      Report,
+	"resume":      Resume,
+	"run":         Run,
+	"search":      Search,
+	"stats":       Stats,
+	"status":      Status,
+	"timesheet":   Timesheet,
+	"total":       Total,
+	"until":       Until,
+	"utilization": Utilization,
+	"verify":      Verify,
+	"wait":        Wait,
+}
+
+// multiFile tells which commands can read several times files at once.
+var multiFile = map[string]bool{
+	"list":        true,
+	"report":      true,
+	"stats":       true,
+	"total":       true,
+	"utilization": true,
+	"verify":      true,
+}
+
+// argc is the number of arguments that a command takes before the file.
+var argc = map[string]int{
+	"annotate": 1,
+	"for":      1,
+	"import":   1,
+	"search":   1,
+	"until":    1,
 }
 
 const timeFormat = "2006-01-02 15:04:05 MST"
 
 // Configuration variables which are read from the command line.
 var (
-	helpFlag  = false
-	quietFlag = false
-	failFlag  = false
-	pathArg   = "TIMES.csv"
+	helpFlag        = false
+	quietFlag       = false
+	billableFlag    = false
+	configFlag      = defaultConfigPath()
+	failFlag        = false
+	ntpFlag         = ""
+	overlapFlag     = overlapAsk
+	removeFlag      = false
+	roundFlag       = time.Duration(0)
+	skewFlag        = time.Minute
+	withinFlag      = time.Minute
+	fromFlag        = ""
+	toFlag          = ""
+	tagFlag         tagList
+	excludeFlag     tagList
+	formatFlag      = ""
+	groupByFlag     = "tag"
+	minDurationFlag = time.Duration(0)
+	noteFlag        = ""
+	regexpFlag      = false
+	beginFlag       = ""
+	endFlag         = ""
+	addTagFlag      tagList
+	removeTagFlag   tagList
+	delimiterFlag   = ""
+	columnsFlag     = ""
+	timeFormatFlag  = ""
+	untilFlag       = ""
+	limitFlag       = 0
+	offsetFlag      = 0
+	recoverFlag     = false
+	strictFlag      = false
+	jsonFlag        = false
+	perFileFlag     = false
+	pathArgs        []string
+	forecastFlag    = false
+	weekFlag        = ""
+	slotFlag        = time.Duration(0)
+	localeFlag      = ""
+	pathArg         = "TIMES.csv"
+	cmdArgs         []string
 )
 
 func init() {
 	flag.Usage = Help
+	flag.Var(&addTagFlag, "add-tag", "add this tag to the annotated entries")
+	flag.StringVar(&beginFlag, "begin", beginFlag, "change the beginning of the last entry")
+	flag.StringVar(&endFlag, "end", endFlag, "change the end of the last entry")
+	flag.BoolVar(&billableFlag, "billable", billableFlag, "mark new entries as billable, or only use billable entries")
+	flag.StringVar(&columnsFlag, "columns", columnsFlag, "the names of the fields in the file that import reads")
+	flag.StringVar(&configFlag, "config", configFlag, "read the configuration from this file")
+	flag.StringVar(&delimiterFlag, "delimiter", delimiterFlag, "the delimiter between fields in the times file")
+	flag.Var(&excludeFlag, "exclude-tag", "leave out entries with this tag")
 	flag.BoolVar(&failFlag, "fail", failFlag, "fail if there is any error in the times file")
+	flag.BoolVar(&forecastFlag, "forecast", forecastFlag, "with stats, project the totals at the end of the week and month")
+	flag.StringVar(&formatFlag, "format", formatFlag, "the format that export or timesheet writes, or import reads")
+	flag.StringVar(&groupByFlag, "group-by", groupByFlag, "group the report by tag, day, or file, or utilization by week or month")
+	flag.StringVar(&fromFlag, "from", fromFlag, "only use entries that begin on or after this date")
 	flag.BoolVar(&helpFlag, "help", helpFlag, "print this usage text for track")
+	flag.BoolVar(&jsonFlag, "json", jsonFlag, "write errors as JSON documents for other programs")
+	flag.StringVar(&localeFlag, "locale", localeFlag, "write durations, dates, and messages for this locale")
+	flag.IntVar(&limitFlag, "limit", limitFlag, "list at most this many entries")
+	flag.StringVar(&noteFlag, "note", noteFlag, "describe new entries with this note")
+	flag.StringVar(&ntpFlag, "ntp", ntpFlag, "check the clock against this NTP server before writing")
+	flag.IntVar(&offsetFlag, "offset", offsetFlag, "skip this many entries before listing")
+	flag.StringVar(&overlapFlag, "overlap", overlapFlag, "how clean resolves overlapping entries")
 	flag.BoolVar(&quietFlag, "quiet", quietFlag, "do not print informative messages")
+	flag.BoolVar(&recoverFlag, "recover", recoverFlag, "read what can be salvaged from a damaged times file")
+	flag.BoolVar(&regexpFlag, "regexp", regexpFlag, "search with a regular expression")
+	flag.BoolVar(&perFileFlag, "per-file", perFileFlag, "with total, print the sum of each file as well")
+	flag.Var(&removeTagFlag, "remove-tag", "remove this tag from the annotated entries")
+	flag.BoolVar(&removeFlag, "remove", removeFlag, "remove the duplicate entries that dupes finds")
+	flag.BoolVar(&strictFlag, "strict", strictFlag, "with verify, also fail for an incomplete last entry or overlaps")
+	flag.Var(&tagFlag, "tag", "tag new entries, or only use entries with this tag")
+	flag.StringVar(&timeFormatFlag, "time-format", timeFormatFlag, "the format of the times in the file that import reads")
+	flag.StringVar(&weekFlag, "week", weekFlag, "the week that timesheet prints, e.g. 2024-W19")
+	flag.StringVar(&untilFlag, "until", untilFlag, "complete the entry at this time instead of upon termination")
+	flag.StringVar(&toFlag, "to", toFlag, "only use entries that begin on or before this date")
+	flag.DurationVar(&minDurationFlag, "min-duration", minDurationFlag, "ignore entries shorter than this, or remove them with clean")
+	flag.DurationVar(&roundFlag, "round", roundFlag, "round the duration of each entry in reports to this unit")
+	flag.DurationVar(&slotFlag, "slot", slotFlag, "snap entries in reports, exports, and timesheets to slots of this size")
+	flag.DurationVar(&skewFlag, "skew", skewFlag, "how far the clock may be off before warning")
+	flag.DurationVar(&withinFlag, "within", withinFlag, "how close entries must begin to be duplicates")
 }
 
 func main() {
-	var command = Status
+	var command, name = Status, "status"
+	var pathGiven bool
 
 	flag.Parse()
+	// Until the configuration is read, messages follow the environment,
+	// so that errors in the configuration are translated as well.
+	setMessages()
 	if helpFlag {
 		Help()
 		return
 	}
 
 	args := flag.Args()
-	n := flag.NArg()
-	if n > 0 {
+	if len(args) > 0 {
+		if which[args[0]] == nil {
+			// The messages follow the configuration, if it can be read,
+			// so that the errors of an alias are translated too.
+			err := loadConfig(configFlag)
+			setMessages()
+			if err == nil {
+				args, err = expandAlias(args)
+			}
+			if err != nil {
+				fail(err)
+			}
+		}
 		command = which[args[0]]
-		if command == nil || n > 2 {
-			Help()
-			os.Exit(2)
+		if command == nil {
+			usage(fmt.Errorf(tr("unknown command %q"), args[0]))
 		}
 
-		if n == 2 {
-			pathArg = args[1]
+		// Options may also be given after the command.
+		name = args[0]
+		n := argc[name]
+		args = parseArgs(args[1:])
+		if len(args) < n || len(args) > n+1 && !multiFile[name] {
+			usage(fmt.Errorf(tr("wrong number of arguments for %s"), name))
+		}
+		cmdArgs = args[:n]
+		if len(args) > n {
+			pathArg, pathArgs = args[n], args[n:]
+			pathGiven = true
+		}
+		if helpFlag {
+			Help()
+			return
 		}
 	}
 
-	err := command()
+	err := loadConfig(configFlag)
+	setMessages()
+	if err == nil {
+		setHumanLocale()
+		if file, ok := config["file"]; ok && !pathGiven {
+			pathArg = file
+		}
+	}
+	var finish func(error) error
+	if err == nil && pathArg == stdio && !streaming[name] {
+		finish, err = pipeTimes(name)
+	}
+	if err == nil {
+		err = setDelimiter(pathArg)
+	}
+	if err == nil {
+		err = setColumns()
+	}
+	if err == nil {
+		err = checkSession(pathArg, mutates(name))
+	}
+	if err == nil {
+		err = command()
+	}
+	if finish != nil {
+		err = finish(err)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		fail(err)
+	}
+}
+
+// isFlagSet returns true if the option called name was given.
+func isFlagSet(name string) bool {
+	var set bool
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// parseArgs parses the options in args, which may be mixed in with the other
+// arguments, and returns the other arguments.
+func parseArgs(args []string) []string {
+	var rest []string
+	for {
+		flag.CommandLine.Parse(args)
+		args = flag.Args()
+		if len(args) == 0 {
+			return rest
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
 	}
 }
 
 func Help() {
-	fmt.Println(`Usage: track [command [file]]
+	fmt.Print(`Usage: track [command [arguments] [file...]] [options]
 
 The default command is:
 	track status TIMES.csv
 
 Commands available are:
-    begin   begin a new time entry
-    end     complete the begun time entry
-    fork    begin a new time entry and fork to terminate later
-    list    list all the times
-    next    begin or end the entry depending on the contents
-    run     begin a new time entry and complete upon termination
-    status  show the current status of the times
-    total   print the sum of all the times
-    verify  verify the validity of the times
-    wait    upon termination, complete the begun time entry
+    annotate     change the note or tags of the entries with the given IDs
+    begin        begin a new time entry
+    clean        sort the times and resolve overlapping entries
+    dupes        report entries that duplicate other entries
+    end          complete the begun time entry
+    export       write the times in the format given by -format
+    for          begin a new time entry and count down the given duration
+    fork         begin a new time entry and fork to terminate later
+    import       merge the times from a CSV file written by another program
+    last         show the most recent entry, or change it with -begin and -end
+    list         list all the times
+    next         begin or end the entry depending on the contents
+    pause        complete the begun time entry until the session is resumed
+    report       print the sum of the times for each tag or day
+    resume       begin a new time entry like the last one, after a break
+    run          begin a new time entry and complete upon termination
+    search       list the times whose tags or note contain a pattern
+    stats        compare the time of this week and month with the schedule
+    status       show the current status of the times
+    timesheet    print the hours of each tag on each day of a week
+    total        print the sum of all the times
+    until        begin a new time entry and complete it at the given time
+    utilization  print how much of the available working time was tracked
+    verify       verify the validity of the times
+    wait         upon termination, complete the begun time entry
+
+Further commands can be defined as aliases in the configuration file.
+
+The commands list, report, stats, total, utilization, and verify may be given
+several files, or quoted patterns like 'projects/*/TIMES.csv', which stand for
+all the files that match them. The entries of all the files are used together.
+
+The file - stands for standard input. Commands that change the times file
+then write the changed file to standard output, and their other output to
+standard error. Questions, such as how to resolve an overlap in clean, are
+then asked on the terminal.
+
+Exit codes are 0 for success, 1 for errors, and 2 for an invalid command
+line. Another command that -fail makes reject the times file exits with 4
+for its invalid entries. Verify exits with 4 for invalid entries and 6 for
+duplicate entries, and with -strict also with 3 if the last entry is
+incomplete and 5 for overlapping entries, or the highest of these.
 
 Options available are:
+   -add-tag	add this tag to the annotated entries
+   -begin	change the beginning of the last entry, e.g. -10m or 09:15
+   -billable	mark new entries as billable, or only use billable entries
+   -columns	the fields in the file to import, e.g. project,begin,end,note
+   -config	read the configuration from this file
+   -delimiter	the delimiter between fields in the times file: , ; or tab
+   -end	change the end of the last entry, e.g. +15m or 17:30
+   -exclude-tag	leave out entries with this tag
    -fail	fail if there are any invalid time entries
+   -forecast	with stats, project the totals at the end of the week and month
+   -format	the format that export writes: csv, tsv, json, ics, timeclock,
+		org, markdown, html, quickbooks, freshbooks, or otlp,
+		that timesheet writes: csv, markdown, or xlsx,
+		or that import reads: csv
+   -from	only use entries that begin on or after this date (YYYY-MM-DD)
+   -group-by	group the report by tag, day, or file (default tag),
+		or utilization by week (default) or month
    -help	print this usage text for track
+   -json	write errors as JSON documents for other programs
+   -limit	list at most this many entries
+   -locale	write durations, dates, and messages for this locale, e.g. de_DE
+   -min-duration	ignore entries shorter than this, or remove them with clean
+   -note	describe new entries with this note
+   -ntp	check the clock against this NTP server before writing
+   -offset	skip this many entries before listing, as with -limit
+   -overlap	how clean resolves overlaps: ask, truncate, delete, split, or keep
+   -per-file	with total, print the sum of each file as well
    -quiet	do not print any informative messages
+   -recover	read what can be salvaged from a damaged times file
+   -regexp	search with a regular expression instead of a substring
+   -remove-tag	remove this tag from the annotated entries
+   -remove	remove the duplicate entries that dupes finds
+   -round	round the duration of each entry in reports to this unit
+   -slot	snap entries in report, export, and timesheet to slots of this size, e.g. 30m
+   -skew	how far the clock may be off before warning (default 1m)
+   -strict	with verify, also fail for an incomplete last entry or overlaps
+   -tag	tag new entries, or only use entries with this tag
+   -time-format	the format of the times to import, e.g. "02.01.2006 15:04"
+   -to	only use entries that begin on or before this date (YYYY-MM-DD)
+   -until	with wait, complete the entry at this time, e.g. 17:30
+   -week	the week that timesheet prints, e.g. 2024-W19 (default this week)
+   -within	how close entries must begin to be duplicates (default 1m)
 `)
 }
 
+// Verify checks the times files for invalid and duplicate entries, and
+// returns an error if it finds any. With the -strict option, an incomplete
+// last entry and overlapping entries are problems too. Each file is checked
+// on its own, and with several files, each problem is printed after the
+// file that it is in.
+//
+// The error has an exit code for the kind of problem, so that scripts can
+// tell them apart:
+//
+//	3  the last entry is incomplete, with -strict
+//	4  some entries are incomplete or invalid
+//	5  some entries overlap each other, with -strict
+//	6  some entries duplicate other entries
+//
+// If there are several kinds, the highest code is used.
 func Verify() error {
+	paths, err := filePaths()
+	if err != nil {
+		return err
+	}
+
+	var (
+		code     = exitOK
+		problems int
+		files    []errorFile
+		lines    []int
+	)
+	for _, path := range paths {
+		prefix := ""
+		if len(paths) > 1 {
+			prefix = path + ": "
+		}
+		c, ls, err := verifyFile(path, prefix)
+		if err != nil {
+			return err
+		}
+		if len(ls) > 0 {
+			problems += len(ls)
+			files = append(files, errorFile{File: path, Lines: ls})
+			lines = ls
+		}
+		if c > code {
+			code = c
+		}
+	}
+
+	if problems > 0 {
+		if len(paths) > 1 {
+			// The lines are only meaningful with the file they are in.
+			err = fmt.Errorf(tr("found %d problems in %d files"), problems, len(files))
+			return &codedError{code: code, err: err, files: files}
+		}
+		err = fmt.Errorf(tr("found %d problems in %s"), problems, paths[0])
+		return &codedError{code: code, err: err, lines: lines}
+	}
+	inform("OK")
 	return nil
 }
 
-func Status() error {
-	return nil
+// verifyFile checks the times file at path like Verify, and prints the
+// problems that it finds after prefix. It returns the exit code for them
+// and their lines in order.
+func verifyFile(path, prefix string) (code int, lines []int, err error) {
+	f, err := openTimes(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	found := func(c int, ls ...int) {
+		lines = append(lines, ls...)
+		if len(ls) > 0 && c > code {
+			code = c
+		}
+	}
+	entries, err := readTimes(f)
+	if err != nil {
+		ferr, ok := err.(*FormatError)
+		if !ok {
+			return 0, nil, err
+		}
+		if ferr.JustIncomplete() && !strictFlag {
+			inform(prefix + ferr.Error())
+		} else {
+			fmt.Println(prefix + ferr.Error())
+			bad := ferr.BadLines
+			if ferr.LastIsBad {
+				bad = bad[:len(bad)-1]
+				if strictFlag {
+					found(exitIncomplete, ferr.BadLines[len(bad)])
+				}
+			}
+			found(exitMalformed, bad...)
+		}
+	}
+
+	dupes := findDuplicates(entries, withinFlag)
+	for i := range dupes {
+		fmt.Println(prefix + dupes[i].String())
+		found(exitDuplicate, dupes[i].Dup.Line)
+	}
+
+	if strictFlag {
+		overlaps := findOverlaps(entries, dupes)
+		for i := range overlaps {
+			fmt.Println(prefix + overlaps[i].String())
+			found(exitOverlap, overlaps[i].Later.Line)
+		}
+	}
+	sort.Ints(lines)
+	return code, lines, nil
 }
 
+// List prints all the completed entries that match the filter options. With
+// the -offset and -limit options, only a page of them is printed: the first
+// entries up to the offset are skipped, and at most limit entries follow.
+//
+// The entries of a single file are listed in the order of the file. The
+// entries of several files are merged in chronological order as they are
+// read, see mergeFiles, and each entry is listed after its file.
 func List() error {
-	return nil
+	match, err := entryFilter()
+	if err != nil {
+		return err
+	}
+	paths, err := filePaths()
+	if err != nil {
+		return err
+	}
+
+	var n, width int
+	page := func(e *Entry) bool {
+		if !match(e) {
+			return true
+		}
+		n++
+		if n <= offsetFlag {
+			return true
+		}
+		if width > 0 {
+			fmt.Printf("%-*s", width+2, e.File)
+		}
+		printEntry(e)
+		return limitFlag <= 0 || n < offsetFlag+limitFlag
+	}
+	if len(paths) == 1 {
+		return scanFile(paths[0], page)
+	}
+
+	for _, path := range paths {
+		if n := utf8.RuneCountInString(path); n > width {
+			width = n
+		}
+	}
+	return mergeFiles(paths, page)
+}
+
+// printEntry prints e on a single line, as used by list.
+func printEntry(e *Entry) {
+	line := fmt.Sprintf("%4d  %s  %s  %*s  %s", e.ID, e.Begin.Format(timeFormat), e.End.Format(timeFormat),
+		durationWidth(), formatDuration(e.Duration()), strings.Join(e.Tags, " "))
+	if e.Note != "" {
+		line += "  " + e.Note
+	}
+	fmt.Println(strings.TrimRight(line, " "))
 }
 
+// Total prints the sum of the durations of the entries that match the filter
+// options. With the -per-file option, the sums of the files that the path
+// stands for are printed as a table above the grand total. The durations are
+// written as Go writes them, such as 2h30m0s, whatever the locale, so that
+// scripts can read them.
 func Total() error {
-	f, err := os.Open(pathArg)
+	match, err := entryFilter()
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	entries, err := readEntries(f, true)
+	paths, err := filePaths()
 	if err != nil {
-		if ferr, ok := err.(*FormatError); ok {
-			if !ferr.JustIncomplete() && failFlag {
-				return err
-			}
-			fmt.Fprintf(os.Stderr, "Warning: %s\n", ferr)
-		} else {
-			return err
+		return err
+	}
+	sums := make([]time.Duration, len(paths))
+	err = scanFiles(paths, func(i int, e *Entry) bool {
+		if match(e) {
+			sums[i] += e.Duration()
 		}
+		return true
+	})
+	if err != nil {
+		return err
 	}
-
 	var sum time.Duration
-	for _, entry := range entries {
-		dur, err := duration(entry[0], entry[1])
-		if err != nil {
-			return err
-		}
-		sum += dur
+	for _, d := range sums {
+		sum += d
+	}
+	if !perFileFlag {
+		fmt.Println(sum)
+		return nil
 	}
-	fmt.Println(sum)
 
-	return nil
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for i, path := range paths {
+		fmt.Fprintf(w, "%s\t%s\n", path, sums[i])
+	}
+	fmt.Fprintf(w, "%s\t%s\n", tr("total"), sum)
+	return w.Flush()
 }
 
 func Begin() error {
+	return beginAt(time.Now())
+}
+
+// beginAt begins a new entry in the times file at the given time.
+func beginAt(now time.Time) error {
 	f, err := os.OpenFile(pathArg, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	return beginEntry(f, failFlag)
+	// Beginning a new entry abandons a paused session.
+	if _, err = unpause(f); err != nil {
+		return err
+	}
+	f.Seek(0, 0)
+	checkSkew(f, now)
+	e, err := withDefaultTag(newEntry(now))
+	if err != nil {
+		return err
+	}
+	if err = beginEntry(f, failFlag, e); err != nil {
+		return err
+	}
+	inform("BEGIN")
+	return nil
 }
 
 func Next() error {
@@ -188,52 +655,229 @@ func Next() error {
 	}
 	defer f.Close()
 
-	_, err = readEntries(f, false)
+	now := time.Now()
+	checkSkew(f, now)
+	_, err = readEntries(f)
 	f.Seek(0, 0)
 	if err != nil {
 		if ferr, ok := err.(*FormatError); ok {
 			if ferr.LastIsBad {
-				return endEntry(f, failFlag)
+				if err = endEntry(f, failFlag, now); err == nil {
+					inform("END")
+				}
+				return err
 			} else if !failFlag {
-				return beginEntry(f, failFlag)
+				return nextBegin(f, now)
 			}
 		}
 		return err
 	} else {
-		return beginEntry(f, failFlag)
+		return nextBegin(f, now)
 	}
 }
 
+func nextBegin(f *os.File, now time.Time) error {
+	if _, err := unpause(f); err != nil {
+		return err
+	}
+	f.Seek(0, 0)
+	e, err := withDefaultTag(newEntry(now))
+	if err != nil {
+		return err
+	}
+	if err := beginEntry(f, failFlag, e); err != nil {
+		return err
+	}
+	inform("BEGIN")
+	return nil
+}
+
 func End() error {
+	return endAt(time.Now())
+}
+
+// endAt completes the begun entry in the times file at the given time.
+func endAt(now time.Time) error {
 	f, err := os.OpenFile(pathArg, os.O_RDWR|os.O_CREATE, 0666)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	return endEntry(f, true)
+	checkSkew(f, now)
+	if err = endEntry(f, true, now); err != nil {
+		return err
+	}
+	inform("END")
+	return nil
 }
 
 func Run() error {
-	err := Begin()
+	start := time.Now()
+	err := beginAt(start)
 	if err != nil {
 		return err
 	}
-	return Wait()
+	return waitFrom(start, time.Time{}, nil)
 }
 
-// Wait blocks until it receives a signal from the operating system, at which
-// it completes the entry in path and exits. If the signal is the Kill signal,
-// i.e. SIGKILL, then we exit right away.
+// Wait blocks until it receives a signal to terminate from the operating
+// system, at which it completes the entry in path and exits. If the signal
+// is the Kill signal, i.e. SIGKILL, then we exit right away. With the -until
+// option, the entry is also completed once that time has come.
 func Wait() error {
+	now := time.Now()
+	var deadline time.Time
+	if untilFlag != "" {
+		var err error
+		if deadline, err = untilTime(untilFlag, now); err != nil {
+			return err
+		}
+	}
+	return waitFrom(now, deadline, nil)
+}
+
+// Until begins a new entry and forks a process that waits to complete it at
+// the time given as argument, such as 17:30, or earlier upon termination.
+func Until() error {
+	now := time.Now()
+	deadline, err := untilTime(cmdArgs[0], now)
+	if err != nil {
+		return err
+	}
+	if err = beginAt(now); err != nil {
+		return err
+	}
+
+	inform("FORK")
+	args := append(waitArgs(), "-until="+deadline.Format(timeFormat), pathArg)
+	cmd := exec.Command(os.Args[0], args...)
+	return cmd.Start()
+}
+
+// untilTime returns the time given by s, as for adjustTime, which must lie
+// after now.
+func untilTime(s string, now time.Time) (time.Time, error) {
+	t, err := adjustTime(s, now)
+	if err != nil {
+		return t, err
+	}
+	if !t.After(now) {
+		return t, fmt.Errorf(tr("%s has already passed"), s)
+	}
+	return t, nil
+}
+
+// waitFrom is like Wait, except that the entry is ended at start plus the
+// time that has passed since start according to the monotonic clock. That
+// way the duration is correct even if the wall clock is changed meanwhile,
+// for example by NTP or a daylight saving time transition. Unless deadline
+// is zero, the entry is ended once the clock reaches it.
+//
+// If the machine is suspended while waiting, the entry is ended when the
+// machine was suspended, unless the key on-suspend in the configuration
+// says that the suspended time counts, or the user says so when asked.
+// Where a suspend cannot be told apart from a change of the wall clock, the
+// suspended time counts by default; see suspendStrategy.
+//
+// Unless cd is nil, the time left until the deadline is shown while waiting,
+// and the alarm of cd sounds when the deadline has come.
+func waitFrom(start, deadline time.Time, cd *countdown) error {
+	strategy, err := suspendStrategy()
+	if err != nil {
+		return err
+	}
+
 	c := make(chan os.Signal, 1)
-	signal.Notify(c)
+	signal.Notify(c, stopSignals...)
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timeout = time.After(time.Until(deadline))
+	}
+	ticker := time.NewTicker(suspendCheck)
+	defer ticker.Stop()
+	var show <-chan time.Time
+	if cd != nil {
+		shower := time.NewTicker(time.Second)
+		defer shower.Stop()
+		show = shower.C
+	}
+	if err = startSession(pathArg); err != nil {
+		return err
+	}
+	defer endSession(pathArg)
 	inform("WAIT")
-	sig := <-c
-	if sig == os.Kill {
-		os.Exit(1)
+	cd.show(start, deadline)
+
+	var (
+		slept time.Duration // the suspended time that counts
+		notes []string      // what happened to the entry while waiting
+	)
+	last := time.Now()
+	meter := newSleepMeter(last)
+	for {
+		select {
+		case sig := <-c:
+			if sig == os.Kill {
+				os.Exit(1)
+			}
+			cd.stop()
+			return markWaited(endWaited(start, slept), notes)
+		case <-timeout:
+			cd.ring()
+			return markWaited(endWaited(start, slept), notes)
+		case <-show:
+			cd.show(time.Now(), deadline)
+		case now := <-ticker.C:
+			if err := beatSession(pathArg, now); err != nil {
+				warn("%v", err)
+			}
+			if gap := meter.since(now); gap > 0 {
+				woke := now.Round(0)
+				from, to := woke.Add(-gap).Format(timeFormat), woke.Format(timeFormat)
+				if !countSuspended(strategy, woke.Add(-gap), woke) {
+					cd.stop()
+					warn("the machine was suspended at %s, so the entry ends then", from)
+					notes = append(notes, fmt.Sprintf("ended when suspended from %s to %s", from, to))
+					return markWaited(endAt(start.Add(last.Sub(start)+slept)), notes)
+				}
+				notes = append(notes, fmt.Sprintf("suspended from %s to %s, which counts", from, to))
+				slept += gap
+			}
+			// The timeout does not count suspended time on all systems.
+			if !deadline.IsZero() && !now.Round(0).Before(deadline) {
+				cd.ring()
+				return markWaited(endAt(deadline), notes)
+			}
+			last = now
+		}
 	}
-	return End()
+}
+
+// markWaited records notes about the entry that waiting completed, unless
+// that failed with err.
+func markWaited(err error, notes []string) error {
+	if err != nil || len(notes) == 0 {
+		return err
+	}
+	f, err := os.OpenFile(pathArg, os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return markLast(f, notes...)
+}
+
+// endWaited ends the entry that began at start, after waiting for it, at
+// start plus the time that has passed according to the monotonic clock and
+// the time that the machine was suspended but that still counts.
+func endWaited(start time.Time, slept time.Duration) error {
+	now := time.Now()
+	end := start.Add(now.Sub(start) + slept)
+	if jump := now.Round(0).Sub(end.Round(0)); jump > skewFlag || -jump > skewFlag {
+		warn("the clock was changed by %s while waiting", jump.Round(time.Second))
+	}
+	return endAt(end)
 }
 
 func Fork() error {
@@ -243,108 +887,205 @@ func Fork() error {
 	}
 
 	inform("FORK")
-	cmd := exec.Command(os.Args[0], "wait", pathArg)
+	cmd := exec.Command(os.Args[0], append(waitArgs(), pathArg)...)
 	return cmd.Start()
 }
 
+// waitArgs returns the arguments of a wait process that completes the begun
+// entry, with the options of forkFlags that were given.
+func waitArgs() []string {
+	args := []string{"wait"}
+	flag.Visit(func(f *flag.Flag) {
+		if forkFlags[f.Name] {
+			args = append(args, "-"+f.Name+"="+f.Value.String())
+		}
+	})
+	return args
+}
+
+// forkFlags are the options that Fork and Until pass on to the wait process,
+// so that it works with the same configuration and times file.
+var forkFlags = map[string]bool{
+	"columns":   true,
+	"config":    true,
+	"delimiter": true,
+	"fail":      true,
+	"locale":    true,
+	"ntp":       true,
+	"quiet":     true,
+	"skew":      true,
+	"until":     true,
+}
+
 // inform prints str if the global var verbose is true.
 func inform(str string) {
 	if !quietFlag {
-		fmt.Println(str)
+		fmt.Println(tr(str))
 	}
 }
 
-// currentTime returns the current time as a string.
-func currentTime() string {
-	return time.Now().Format(timeFormat)
+// checkClock returns an error if now lies before the time recorded last in
+// the times file, which means that the system clock has gone backwards.
+func checkClock(now time.Time, last string) error {
+	t, err := time.Parse(timeFormat, last)
+	if err != nil || !now.Before(t) {
+		return nil
+	}
+	return fmt.Errorf(tr("the clock is behind the times file: it is %s, but %s is already recorded"),
+		now.Format(timeFormat), last)
 }
 
-// readEntries reads all the entries from r and filters the bad ones out if
-// filter is true.
+// readEntries reads all the entries from r and returns the last record,
+// which is nil if there is none. Only the last record is kept, so that the
+// size of the file does not matter.
 //
 // If err is not nil, then it could be of the type *FormatError, or it could
 // also originate from csv, in which case just treat it as you would any other
 // unknown error.
-func readEntries(r io.Reader, filter bool) (entries [][]string, err error) {
-	reader := csv.NewReader(r)
-	reader.FieldsPerRecord = -1
-
-	entries, err = reader.ReadAll()
-	if err != nil {
-		return
-	}
+func readEntries(r io.Reader) (last []string, err error) {
+	reader := newReader(r)
+	reader.ReuseRecord = true
 
 	var formatErr FormatError
-	for i, entry := range entries {
-		if len(entry) == 2 {
+	for {
+		entry, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		entry = fromFile(entry)
+		last = append(last[:0], entry...)
+
+		if complete(entry) {
 			formatErr.LastIsBad = false
 		} else {
 			formatErr.LastIsBad = true
 			if formatErr.BadLines == nil {
 				formatErr.BadLines = make([]int, 0, 2)
 			}
-			formatErr.BadLines = append(formatErr.BadLines, i+1)
+			line, _ := reader.FieldPos(0)
+			formatErr.BadLines = append(formatErr.BadLines, line)
 		}
 	}
 	if formatErr.BadLines != nil {
 		err = &formatErr
-
-		if filter {
-			n := len(entries) - len(formatErr.BadLines)
-			filtered := make([][]string, n)
-			var i int
-			for _, entry := range entries {
-				if len(entry) == 2 {
-					filtered[i] = entry
-					i++
-				}
-			}
-			entries = filtered
-		}
 	}
-
 	return
 }
 
-func beginEntry(rw io.ReadWriter, fail bool) error {
-	_, err := readEntries(rw, false)
+// beginEntry appends the begun entry e. It is not an error to begin an
+// entry while the clock is behind the last entry, unless fail is true.
+func beginEntry(rw io.ReadWriter, fail bool, e *Entry) error {
+	last, err := readEntries(rw)
 	if err != nil {
 		if _, ok := err.(*FormatError); fail || !ok {
 			return err
 		}
-		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		warn("%v", err)
+	}
+	if last != nil {
+		if err := checkClock(e.Begin, lastTime(last)); err != nil {
+			if fail {
+				return err
+			}
+			warn("%v", err)
+		}
 	}
 
-	writer := csv.NewWriter(rw)
-	writer.Write([]string{currentTime()})
+	writer := newWriter(rw)
+	writer.Write(toFile(e.Record(), nil))
 	writer.Flush()
-	inform("BEGIN")
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	publishEvent("begin", e)
+	return nil
+}
+
+// endEntry completes the begun entry at now, and warns about the budgets of
+// its tags. An entry is never ended before it began, since that would give
+// it a negative duration.
+func endEntry(f *os.File, fail bool, now time.Time) error {
+	last, err := readEntries(f)
+	if err == nil {
+		return errors.New(tr("no incomplete entry to end"))
+	}
+	ferr, ok := err.(*FormatError)
+	if !ok || !ferr.LastIsBad {
+		return err
+	}
+	if len(ferr.BadLines) > 1 {
+		if fail {
+			return err
+		}
+		warn("%v", err)
+	}
+
+	if !begun(last) {
+		return fmt.Errorf(tr("invalid entry on line %d"), ferr.BadLines[len(ferr.BadLines)-1])
+	}
+	if err := checkClock(now, last[colBegin]); err != nil {
+		return err
+	}
+	record := []string{last[colBegin], now.Format(timeFormat)}
+	if len(last) > colTags {
+		record = append(record, last[colTags:]...)
+	}
+	if err = replaceLast(f, record); err != nil {
+		return err
+	}
+	if e, err := parseEntry(record, 0); err == nil {
+		publishEvent("end", &e)
+	}
+
+	f.Seek(0, 0)
+	entries, _ := readTimes(f)
+	if n := len(entries); n > 0 {
+		return warnBudgets(entries, &entries[n-1])
+	}
 	return nil
 }
 
-func endEntry(rw io.ReadWriteSeeker, fail bool) error {
-	entries, err := readEntries(rw, false)
+// replaceLast replaces the last record in f with record, keeping whatever
+// follows it in the file, such as comments.
+func replaceLast(f *os.File, record []string) error {
+	f.Seek(0, 0)
+	data, err := io.ReadAll(f)
 	if err != nil {
-		if ferr, ok := err.(*FormatError); ok && ferr.LastIsBad {
-			if len(ferr.BadLines) > 1 {
-				if fail {
-					return err
-				}
-				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
-			}
+		return err
+	}
+	last, begin, end, err := lastRecord(data)
+	if err != nil {
+		return err
+	}
+	if last == nil {
+		return errors.New(tr("no entry to replace"))
+	}
 
-			last := append(entries[len(entries)-1], currentTime())
-			rw.Seek(-int64(len(last[0])+1), 2) // rewind the last transaction
-			writer := csv.NewWriter(rw)
-			writer.Write(last)
-			writer.Flush()
-			inform("END")
-			return nil
-		}
+	fields, err := newReader(bytes.NewReader(data[begin:end])).Read()
+	if err != nil {
 		return err
-	} else {
-		return errors.New("no incomplete entry to end")
 	}
+
+	var buf bytes.Buffer
+	writer := newWriter(&buf)
+	writer.Write(toFile(record, fields))
+	writer.Flush()
+	buf.Write(data[end:])
+	if err = f.Truncate(begin); err != nil {
+		return err
+	}
+	_, err = f.WriteAt(buf.Bytes(), begin)
+	return err
+}
+
+// lastTime returns the last time that is recorded in record.
+func lastTime(record []string) string {
+	if complete(record) {
+		return record[colEnd]
+	}
+	return record[colBegin]
 }
 
 // spokenList returns the list as a string as it would be written in English.
@@ -356,25 +1097,11 @@ func spokenList(list []int) string {
 			b.WriteString(", ")
 		} else if i < n-1 {
 			if n == 2 {
-				b.WriteString(" and ")
+				b.WriteString(tr(" and "))
 			} else {
-				b.WriteString(", and ")
+				b.WriteString(tr(", and "))
 			}
 		}
 	}
 	return b.String()
 }
-
-// duration returns the interpretated duration between two times.
-func duration(from, to string) (dur time.Duration, err error) {
-	begin, err := time.Parse(timeFormat, from)
-	if err != nil {
-		return
-	}
-	end, err := time.Parse(timeFormat, to)
-	if err != nil {
-		return
-	}
-	dur = end.Sub(begin)
-	return
-}
@@ -0,0 +1,237 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// catalogs hold the translations of the messages for people by language.
+// A message is looked up by its English text, which is also what is used if
+// there is no translation. A translation of a format can change the order
+// of the arguments with explicit indexes, such as %[2]s.
+var catalogs = map[string]map[string]string{
+	"de": {
+		// Informative messages
+		"ANNOTATED %d": "GEÄNDERT %d",
+		"BEGIN":        "BEGONNEN",
+		"CLEAN":        "BEREINIGT",
+		"END":          "BEENDET",
+		"FORK":         "GESTARTET",
+		"IMPORTED %d":  "IMPORTIERT %d",
+		"OK":           "OK",
+		"PAUSE":        "PAUSIERT",
+		"REMOVED %d":   "ENTFERNT %d",
+		"RESUME":       "FORTGESETZT",
+		"WAIT":         "WARTET",
+
+		// Warnings and errors
+		"%s is not a positive duration":                                    "%s ist keine positive Dauer",
+		"%s has already passed":                                            "%s ist bereits vorbei",
+		"the machine was suspended at %s, so the entry ends then":          "der Rechner war ab %s im Ruhezustand, also endet der Eintrag da",
+		"The machine was suspended from %s to %s. Count this time? [y/n] ": "Der Rechner war von %s bis %s im Ruhezustand. Zählt diese Zeit? [j/n] ",
+		"y": "j",
+		"the wait process for the begun entry died, and was last seen at %s": "der Warteprozess des begonnenen Eintrags ist abgestürzt und lief zuletzt um %s",
+		"standard input (%s) cannot be read along with other times files":    "die Standardeingabe (%s) kann nicht zusammen mit anderen Zeitdateien gelesen werden",
+		"no files match %s":                            "keine Dateien passen zu %s",
+		"skipped %d damaged lines":                     "%d beschädigte Zeilen übersprungen",
+		"line %d: %s":                                  "Zeile %d: %s",
+		"only null bytes":                              "nur Nullbytes",
+		"incomplete entry":                             "unvollständiger Eintrag",
+		"empty record":                                 "leerer Datensatz",
+		"more than one record":                         "mehr als ein Datensatz",
+		"unknown command %q":                           "unbekannter Befehl %q",
+		"wrong number of arguments for %s":             "falsche Anzahl von Argumenten für %s",
+		"see track -help for the commands and options": "siehe track -help für die Befehle und Optionen",
+		"complete the last entry with track end":       "den letzten Eintrag mit track end abschließen",
+		"correct or remove the lines, or read the file with -recover":              "die Zeilen korrigieren oder entfernen, oder die Datei mit -recover lesen",
+		"resolve the overlaps with track clean":                                    "die Überschneidungen mit track clean auflösen",
+		"remove the duplicates with track dupes -remove":                           "die Duplikate mit track dupes -remove entfernen",
+		"correct or remove the lines":                                              "die Zeilen korrigieren oder entfernen",
+		"%s cannot use standard input as the times file":                           "%s kann die Standardeingabe nicht als Zeitdatei verwenden",
+		"no export format given with -format; the formats are %s":                  "kein Exportformat mit -format angegeben; die Formate sind %s",
+		"unknown export format %q; the formats are %s":                             "unbekanntes Exportformat %q; die Formate sind %s",
+		"unknown timesheet format %q; the formats are csv, markdown, and xlsx":     "unbekanntes Format %q für timesheet; die Formate sind csv, markdown und xlsx",
+		"invalid week %q, which should be like 2024-W19":                           "ungültige Woche %q, die wie 2024-W19 sein sollte",
+		"slots of %s do not divide a day evenly":                                   "Slots von %s teilen einen Tag nicht gleichmäßig auf",
+		"there is no week %d in %d":                                                "es gibt keine Woche %d im Jahr %d",
+		"Error":                                                                    "Fehler",
+		"Warning":                                                                  "Warnung",
+		" and ":                                                                    " und ",
+		", and ":                                                                   " und ",
+		"last entry is incomplete":                                                 "der letzte Eintrag ist unvollständig",
+		"incomplete or invalid entry on line %d":                                   "unvollständiger oder ungültiger Eintrag in Zeile %d",
+		"incomplete or invalid entries on lines %s":                                "unvollständige oder ungültige Einträge in den Zeilen %s",
+		"found %d problems in %s":                                                  "%d Probleme in %s gefunden",
+		"found %d problems in %d files":                                            "%d Probleme in %d Dateien gefunden",
+		"no incomplete entry to end":                                               "kein unvollständiger Eintrag zu beenden",
+		"cannot check the clock: %v":                                               "die Uhr kann nicht geprüft werden: %v",
+		"the clock differs from %s by %s":                                          "die Uhr weicht um %[2]s von %[1]s ab",
+		"the clock was changed by %s while waiting":                                "die Uhr wurde während des Wartens um %s verstellt",
+		"%s was modified at %s, which is later than the clock":                     "%s wurde um %s geändert, also später als die Uhr anzeigt",
+		"the clock is behind the times file: it is %s, but %s is already recorded": "die Uhr geht nach: es ist %s, aber %s ist bereits eingetragen",
+
+		// Questions and problems
+		"Line %d: %s": "Zeile %d: %s",
+		"Overlap: [t]runcate earlier, [d]elete shorter, [s]plit, [k]eep? ": "Überschneidung: früheren [k]ürzen, kürzeren [l]öschen, [t]eilen, [b]ehalten? ",
+		"t":                              "k",
+		"d":                              "l",
+		"s":                              "t",
+		"k":                              "b",
+		"line %d overlaps line %d by %s": "Zeile %d überschneidet sich um %[3]s mit Zeile %[2]d",
+		"line %d duplicates line %d":     "Zeile %d ist ein Duplikat von Zeile %d",
+		"line %d nearly duplicates line %d (begins %s apart)": "Zeile %d ist fast ein Duplikat von Zeile %d (beginnt %s entfernt)",
+		"line %d: %v":                                 "Zeile %d: %v",
+		"Importing %d entries from %s":                "Importiere %d Einträge aus %s",
+		", leaving out %d already in %s":              ", ohne %d, die schon in %s sind",
+		"and %d more":                                 "und %d weitere",
+		"Merge %d entries into %s? [y/n] ":            "%d Einträge in %s übernehmen? [j/n] ",
+		"The first record has the fields:":            "Der erste Datensatz hat die Felder:",
+		"Field with the beginning (1-%d): ":           "Feld mit dem Beginn (1-%d): ",
+		"Field with the end (1-%d): ":                 "Feld mit dem Ende (1-%d): ",
+		"Field with the tags (1-%d, empty if none): ": "Feld mit den Tags (1-%d, leer wenn keines): ",
+		"Field with the note (1-%d, empty if none): ": "Feld mit der Notiz (1-%d, leer wenn keines): ",
+
+		// Errors
+		"%s lies after %s, so there are no days":                   "%s liegt nach %s, also gibt es keine Tage",
+		"%s: no records to import":                                 "%s: keine Datensätze zu importieren",
+		"%s:%d: %q is not a date":                                  "%s:%d: %q ist kein Datum",
+		"%s:%d: invalid start of an event":                         "%s:%d: ungültiger Beginn eines Termins",
+		"%d: expected = after %s":                                  "%d: = nach %s erwartet",
+		"%d: invalid table header":                                 "%d: ungültiger Tabellenkopf",
+		"%d: invalid table name":                                   "%d: ungültiger Tabellenname",
+		"%d: unexpected %q after value":                            "%d: unerwartetes %q nach dem Wert",
+		"alias %s is empty":                                        "Alias %s ist leer",
+		"alias %s refers to itself":                                "Alias %s verweist auf sich selbst",
+		"bad pattern %q: %v":                                       "ungültiges Muster %q: %v",
+		"cannot group by %q":                                       "kann nicht nach %q gruppieren",
+		"cannot import format %q":                                  "kann das Format %q nicht importieren",
+		"column %s is given twice":                                 "Spalte %s ist doppelt angegeben",
+		"columns do not contain begin":                             "die Spalten enthalten nicht begin",
+		"config: %s is not a duration: %q":                         "Konfiguration: %s ist keine Dauer: %q",
+		"config: %s is not a number: %q":                           "Konfiguration: %s ist keine Zahl: %q",
+		"config: budgets.%s is not a duration: %q":                 "Konfiguration: budgets.%s ist keine Dauer: %q",
+		"config: holidays: %q is not a date":                       "Konfiguration: holidays: %q ist kein Datum",
+		"config: infer-tag must be dir or git, not %q":             "Konfiguration: infer-tag muss dir oder git sein, nicht %q",
+		"config: rate for %s is not a number: %q":                  "Konfiguration: der Satz für %s ist keine Zahl: %q",
+		"config: schedule.%s is not a day of the week":             "Konfiguration: schedule.%s ist kein Wochentag",
+		"config: timesheet.days: %q is not a day of the week":      "Konfiguration: timesheet.days: %q ist kein Wochentag",
+		"config: timesheet.hours is neither decimal nor clock: %q": "Konfiguration: timesheet.hours ist weder decimal noch clock: %q",
+		"config: unknown currency %q":                              "Konfiguration: unbekannte Währung %q",
+		"config: unknown on-suspend strategy %q":                   "Konfiguration: unbekannte Strategie %q für on-suspend",
+		"config: unknown round-mode %q":                            "Konfiguration: unbekannter round-mode %q",
+		"connection refused with code %d":                          "Verbindung mit Code %d abgelehnt",
+		"entry ends before it begins":                              "der Eintrag endet, bevor er beginnt",
+		"entry has no end":                                         "der Eintrag hat kein Ende",
+		"invalid delimiter %q":                                     "ungültiges Trennzeichen %q",
+		"invalid entry ID %q":                                      "ungültige Eintrags-ID %q",
+		"invalid entry on line %d":                                 "ungültiger Eintrag in Zeile %d",
+		"invalid escape \\%c in string":                            "ungültige Escape-Sequenz \\%c in der Zeichenkette",
+		"invalid key %q":                                           "ungültiger Schlüssel %q",
+		"invalid response from NTP server":                         "ungültige Antwort vom NTP-Server",
+		"missing value":                                            "fehlender Wert",
+		"no answer given":                                          "keine Antwort gegeben",
+		"no answer given for overlap":                              "keine Antwort für die Überschneidung gegeben",
+		"no entries to annotate":                                   "keine Einträge zu ändern",
+		"no entry to replace":                                      "kein Eintrag zu ersetzen",
+		"no pid in session file":                                   "keine PID in der Sitzungsdatei",
+		"no previous entry to resume":                              "kein vorheriger Eintrag zum Fortsetzen",
+		"nothing imported":                                         "nichts importiert",
+		"nothing to annotate: use -note, -add-tag, or -remove-tag": "nichts zu ändern: -note, -add-tag oder -remove-tag verwenden",
+		"the entry would begin before the previous one ends at %s": "der Eintrag würde beginnen, bevor der vorige um %s endet",
+		"the entry would end before it begins":                     "der Eintrag würde enden, bevor er beginnt",
+		"the entry would lie in the future":                        "der Eintrag läge in der Zukunft",
+		"the last entry has not been completed yet":                "der letzte Eintrag ist noch nicht abgeschlossen",
+		"the last entry is invalid":                                "der letzte Eintrag ist ungültig",
+		"there are no entries":                                     "es gibt keine Einträge",
+		"trailing backslash":                                       "Backslash am Ende",
+		"unexpected reply to connect":                              "unerwartete Antwort auf die Verbindung",
+		"unknown overlap strategy %q":                              "unbekannte Strategie %q für Überschneidungen",
+		"unknown time format: use -time-format":                    "unbekanntes Zeitformat: -time-format verwenden",
+		"unterminated quote":                                       "nicht abgeschlossenes Anführungszeichen",
+		"unterminated quoted field":                                "nicht abgeschlossenes Feld in Anführungszeichen",
+		"unterminated string":                                      "nicht abgeschlossene Zeichenkette",
+
+		"%s has used %d%% of its monthly budget of %s": "%s hat %d%% des Monatsbudgets von %s verbraucht",
+		"%s is over its monthly budget of %s by %s":    "%s liegt %[3]s über dem Monatsbudget von %[2]s",
+
+		// Status
+		"left:":                  "übrig:",
+		"not tracking":           "keine Zeiterfassung",
+		"paused since %s":        "pausiert seit %s",
+		"today: %s":              "heute: %s",
+		"today: %s of %s":        "heute: %s von %s",
+		"tracking since %s (%s)": "erfasst seit %s (%s)",
+
+		// Report headers
+		"amount":     "Betrag",
+		"budget":     "Budget",
+		"used":       "verbraucht",
+		"raw":        "erfasst",
+		"rounded":    "gerundet",
+		"total":      "gesamt",
+		"difference": "Differenz",
+		"(untagged)": "(ohne Tag)",
+
+		// Stats
+		"week":           "Woche",
+		"month":          "Monat",
+		"tracked":        "erfasst",
+		"scheduled":      "geplant",
+		"per day":        "pro Tag",
+		"forecast":       "Prognose",
+		"goal":           "Ziel",
+		"needed per day": "nötig pro Tag",
+		"available":      "verfügbar",
+		"utilization":    "Auslastung",
+
+		// Timesheet headers
+		"tag": "Tätigkeit",
+		"Mon": "Mo",
+		"Tue": "Di",
+		"Wed": "Mi",
+		"Thu": "Do",
+		"Fri": "Fr",
+		"Sat": "Sa",
+		"Sun": "So",
+
+		// Export headers
+		"begin":    "Beginn",
+		"end":      "Ende",
+		"duration": "Dauer",
+		"tags":     "Tags",
+		"note":     "Notiz",
+	},
+}
+
+// messages are the translations for the language of the user, or nil if
+// messages are written in English.
+var messages map[string]string
+
+// setMessages sets messages from the key locale in the configuration, or
+// else from the environment.
+func setMessages() {
+	messages = nil
+	for _, k := range localeKeys(localeName("LC_ALL", "LC_MESSAGES", "LANG")) {
+		if c, ok := catalogs[k]; ok {
+			messages = c
+			return
+		}
+	}
+}
+
+// tr returns the translation of the message s.
+func tr(s string) string {
+	if t, ok := messages[s]; ok {
+		return t
+	}
+	return s
+}
+
+// warn prints the translation of the warning format to standard error.
+func warn(format string, a ...interface{}) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", tr("Warning"), fmt.Sprintf(tr(format), a...))
+}
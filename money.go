@@ -0,0 +1,211 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// A rateTable holds the hourly rates from the configuration, which look
+// like this:
+//
+//	rate = 50 # the default rate
+//
+//	[rates]
+//	clientA = 80
+//	"clientA:support" = 60
+type rateTable struct {
+	def  float64
+	tags map[string]float64
+}
+
+// loadRates returns the rate table from the configuration, or nil if no
+// rates are configured.
+func loadRates() (*rateTable, error) {
+	table := configTable("rates")
+	if _, ok := config["rate"]; !ok && len(table) == 0 {
+		return nil, nil
+	}
+
+	def, err := configFloat("rate", 0)
+	if err != nil {
+		return nil, err
+	}
+	rt := &rateTable{def: def, tags: make(map[string]float64, len(table))}
+	for tag, v := range table {
+		rt.tags[tag], err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf(tr("config: rate for %s is not a number: %q"), tag, v)
+		}
+	}
+	return rt, nil
+}
+
+// Rate returns the hourly rate for e. The rate of the most specific tag is
+// used, so client:project takes precedence over client, and if none of the
+// tags of e have a rate, the default rate is used.
+func (rt *rateTable) Rate(e *Entry) float64 {
+	tag := specificTag(e, func(t string) bool {
+		_, ok := rt.tags[t]
+		return ok
+	})
+	if tag == "" {
+		return rt.def
+	}
+	return rt.tags[tag]
+}
+
+// A currency describes how amounts of money in it are written.
+type currency struct {
+	symbol   string
+	decimals int
+}
+
+var currencies = map[string]currency{
+	"AUD": {"A$", 2},
+	"CAD": {"C$", 2},
+	"CHF": {"CHF", 2},
+	"DKK": {"kr.", 2},
+	"EUR": {"€", 2},
+	"GBP": {"£", 2},
+	"JPY": {"¥", 0},
+	"NOK": {"kr", 2},
+	"SEK": {"kr", 2},
+	"USD": {"$", 2},
+}
+
+// A numberLocale describes how numbers and amounts of money are written in a
+// locale.
+type numberLocale struct {
+	decimal     string
+	group       string
+	symbolFirst bool // the currency comes before the amount
+	symbolSpace bool // the currency is separated from the amount by a space
+}
+
+var numberLocales = map[string]numberLocale{
+	"de":    {",", ".", false, true},
+	"de_AT": {",", "\u00a0", true, true},
+	"de_CH": {".", "’", true, true},
+	"en":    {".", ",", true, false},
+	"es":    {",", ".", false, true},
+	"fr":    {",", "\u202f", false, true},
+	"it":    {",", ".", false, true},
+	"nl":    {",", ".", true, true},
+	"pt":    {",", ".", false, true},
+	"sv":    {",", "\u00a0", false, true},
+}
+
+// localeName returns the name of the locale that is set by the -locale
+// option, the configuration, or else by the environment, such as
+// de_DE.UTF-8.
+func localeName(envs ...string) string {
+	if localeFlag != "" {
+		return localeFlag
+	}
+	if name, ok := config["locale"]; ok {
+		return name
+	}
+	for _, env := range envs {
+		if name := os.Getenv(env); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// localeKeys returns the keys under which the locale called name, such as
+// de_CH.UTF-8, is looked up: first by language and territory, then only
+// by language.
+func localeKeys(name string) []string {
+	if i := strings.IndexAny(name, ".@"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.Replace(name, "-", "_", 1)
+	if i := strings.IndexByte(name, '_'); i >= 0 {
+		return []string{name, strings.ToLower(name[:i])}
+	}
+	return []string{strings.ToLower(name)}
+}
+
+// A moneyFormat formats amounts of money according to the currency and
+// locale in the configuration.
+type moneyFormat struct {
+	currency currency
+	locale   numberLocale
+	local    bool // the locale is known
+}
+
+// loadMoneyFormat returns the money format from the configuration, where the
+// currency is given by its ISO 4217 code:
+//
+//	currency = "EUR"
+//	locale = "de_DE"
+//
+// Without a locale, the locale of the environment is used. Without either,
+// amounts are written in a plain format, such as 1234.56.
+func loadMoneyFormat() (*moneyFormat, error) {
+	mf := &moneyFormat{currency: currency{decimals: 2}}
+	if code, ok := config["currency"]; ok {
+		c, ok := currencies[strings.ToUpper(code)]
+		if !ok {
+			return nil, fmt.Errorf(tr("config: unknown currency %q"), code)
+		}
+		mf.currency = c
+	}
+	for _, k := range localeKeys(localeName("LC_ALL", "LC_MONETARY", "LANG")) {
+		if mf.locale, mf.local = numberLocales[k]; mf.local {
+			break
+		}
+	}
+	if !mf.local {
+		mf.locale = numberLocale{decimal: ".", symbolFirst: true}
+	}
+	return mf, nil
+}
+
+// Format formats amount, rounded to the precision of the currency.
+func (mf *moneyFormat) Format(amount float64) string {
+	scale := math.Pow10(mf.currency.decimals)
+	units := math.Round(math.Abs(amount) * scale)
+	s := strconv.FormatFloat(units/scale, 'f', mf.currency.decimals, 64)
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+
+	var b strings.Builder
+	if amount < 0 && units != 0 {
+		b.WriteByte('-')
+	}
+	sym := mf.currency.symbol
+	if sym != "" && mf.locale.symbolFirst {
+		b.WriteString(sym)
+		if mf.locale.symbolSpace {
+			b.WriteByte(' ')
+		}
+	}
+	for i := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(mf.locale.group)
+		}
+		b.WriteByte(whole[i])
+	}
+	if frac != "" {
+		b.WriteString(mf.locale.decimal)
+		b.WriteString(frac)
+	}
+	if sym != "" && !mf.locale.symbolFirst {
+		if mf.locale.symbolSpace {
+			b.WriteByte(' ')
+		}
+		b.WriteString(sym)
+	}
+	return b.String()
+}
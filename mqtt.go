@@ -0,0 +1,174 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// mqttTimeout limits how long publishing an event may take, so that track
+// does not hang if the broker cannot be reached. The status is published
+// with the much shorter mqttStatusTimeout, since it is shown so often.
+const (
+	mqttTimeout       = 5 * time.Second
+	mqttStatusTimeout = 300 * time.Millisecond
+)
+
+// An event is what is published over MQTT when an entry begins or ends, or
+// when the status is shown.
+type event struct {
+	Event    string   `json:"event"`
+	Tracking bool     `json:"tracking"`
+	Begin    string   `json:"begin,omitempty"`
+	End      string   `json:"end,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Note     string   `json:"note,omitempty"`
+}
+
+// publishEvent publishes the event called name for e, which may be nil if
+// no entry is running, to the MQTT broker in the configuration:
+//
+//	[mqtt]
+//	broker = "localhost:1883"
+//	topic = "home/office/track"
+//	retain = true
+//	status = true
+//
+// The keys client-id, username, and password are optional. With retain, the
+// broker keeps the last event for clients that subscribe later. The status
+// event is only published with status, since the status is shown by every
+// plain track, and it is given up on quickly. Nothing is published without a
+// broker, and failing to publish is only a warning.
+func publishEvent(name string, e *Entry) {
+	broker := config["mqtt.broker"]
+	if broker == "" {
+		return
+	}
+	timeout := mqttTimeout
+	if name == "status" {
+		if config["mqtt.status"] != "true" {
+			return
+		}
+		timeout = mqttStatusTimeout
+	}
+	topic := config["mqtt.topic"]
+	if topic == "" {
+		topic = "track"
+	}
+
+	ev := event{Event: name}
+	if e != nil {
+		ev.Tracking = e.End.IsZero()
+		ev.Begin = e.Begin.Format(time.RFC3339)
+		if !e.End.IsZero() {
+			ev.End = e.End.Format(time.RFC3339)
+		}
+		ev.Tags, ev.Note = e.Tags, e.Note
+	}
+	payload, err := json.Marshal(ev)
+	if err == nil {
+		err = mqttPublish(broker, topic, payload, config["mqtt.retain"] == "true", timeout)
+	}
+	if err != nil {
+		warn("mqtt: %v", err)
+	}
+}
+
+// mqttPublish connects to broker with MQTT 3.1.1 and publishes payload to
+// topic with QoS 0, giving up after timeout.
+func mqttPublish(broker, topic string, payload []byte, retain bool, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", broker, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	clientID := config["mqtt.client-id"]
+	if clientID == "" {
+		clientID = "track"
+	}
+	user, password := config["mqtt.username"], config["mqtt.password"]
+
+	// CONNECT with a clean session and a keep-alive of one minute.
+	var b bytes.Buffer
+	writeMQTTString(&b, "MQTT")
+	flags := byte(0x02)
+	if user != "" {
+		flags |= 0x80
+		if password != "" {
+			flags |= 0x40
+		}
+	}
+	b.Write([]byte{4, flags, 0, 60})
+	writeMQTTString(&b, clientID)
+	if user != "" {
+		writeMQTTString(&b, user)
+		if password != "" {
+			writeMQTTString(&b, password)
+		}
+	}
+	if err = writeMQTTPacket(conn, 0x10, b.Bytes()); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+	ack := make([]byte, 4)
+	if _, err = io.ReadFull(r, ack); err != nil {
+		return err
+	}
+	if ack[0] != 0x20 || ack[1] != 2 {
+		return errors.New(tr("unexpected reply to connect"))
+	}
+	if ack[3] != 0 {
+		return fmt.Errorf(tr("connection refused with code %d"), ack[3])
+	}
+
+	b.Reset()
+	writeMQTTString(&b, topic)
+	b.Write(payload)
+	header := byte(0x30)
+	if retain {
+		header |= 0x01
+	}
+	if err = writeMQTTPacket(conn, header, b.Bytes()); err != nil {
+		return err
+	}
+	return writeMQTTPacket(conn, 0xe0, nil)
+}
+
+// writeMQTTPacket writes a packet with the given first byte of the header
+// and the rest of the packet.
+func writeMQTTPacket(w io.Writer, header byte, rest []byte) error {
+	buf := []byte{header}
+	n := len(rest)
+	for {
+		c := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			c |= 0x80
+		}
+		buf = append(buf, c)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := w.Write(append(buf, rest...))
+	return err
+}
+
+// writeMQTTString writes s prefixed by its length.
+func writeMQTTString(b *bytes.Buffer, s string) {
+	b.WriteByte(byte(len(s) >> 8))
+	b.WriteByte(byte(len(s)))
+	b.WriteString(s)
+}
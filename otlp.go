@@ -0,0 +1,183 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// otlpBatch is the largest number of spans sent to the collector at once.
+const otlpBatch = 1000
+
+// The parts of the OTLP/JSON encoding of traces that entries are sent in.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID    string          `json:"traceId"`
+		SpanID     string          `json:"spanId"`
+		Name       string          `json:"name"`
+		Kind       int             `json:"kind"`
+		Start      string          `json:"startTimeUnixNano"`
+		End        string          `json:"endTimeUnixNano"`
+		Attributes []otlpAttribute `json:"attributes,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		String *string `json:"stringValue,omitempty"`
+		Bool   *bool   `json:"boolValue,omitempty"`
+	}
+)
+
+// An otlpExporter sends the entries as OTLP spans to the collector in the
+// configuration, or writes them to w if there is none:
+//
+//	[otlp]
+//	endpoint = "http://localhost:4318"
+//	service-name = "track"
+//
+//	[otlp.headers]
+//	Authorization = "Bearer secret"
+//
+// Each entry becomes a span named after its most specific tag, with its
+// tags and note as attributes. The entries of a day form a trace. The IDs
+// are derived from the entries, so exporting an entry again gives the same
+// span. The spans are sent in batches of otlpBatch, and written all at once.
+type otlpExporter struct {
+	w        io.Writer
+	endpoint string
+	spans    []otlpSpan
+}
+
+func newOTLPExporter(w io.Writer) exporter {
+	endpoint := config["otlp.endpoint"]
+	if endpoint != "" && !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint = strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return &otlpExporter{w: w, endpoint: endpoint}
+}
+
+func (x *otlpExporter) Write(e *Entry) error {
+	x.spans = append(x.spans, otlpSpanOf(e))
+	if x.endpoint != "" && len(x.spans) == otlpBatch {
+		return x.send()
+	}
+	return nil
+}
+
+func (x *otlpExporter) Close() error {
+	if x.endpoint == "" {
+		enc := json.NewEncoder(x.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(otlpRequestOf(x.spans))
+	}
+	if len(x.spans) > 0 {
+		return x.send()
+	}
+	return nil
+}
+
+// send sends the spans that have not been sent yet to the collector.
+func (x *otlpExporter) send() error {
+	err := postOTLP(x.endpoint, otlpRequestOf(x.spans))
+	x.spans = x.spans[:0]
+	return err
+}
+
+// otlpRequestOf returns the request that exports spans.
+func otlpRequestOf(spans []otlpSpan) otlpRequest {
+	service := config["otlp.service-name"]
+	if service == "" {
+		service = "track"
+	}
+	return otlpRequest{[]otlpResourceSpans{{
+		Resource:   otlpResource{[]otlpAttribute{otlpString("service.name", service)}},
+		ScopeSpans: []otlpScopeSpans{{otlpScope{"track"}, spans}},
+	}}}
+}
+
+// otlpSpanOf returns e as a span.
+func otlpSpanOf(e *Entry) otlpSpan {
+	name := nameOf(e)
+	trace := sha256.Sum256([]byte("track " + e.Begin.Local().Format(dateFormat)))
+	span := entryDigest(e)
+	billable := e.Billable()
+	s := otlpSpan{
+		TraceID: hex.EncodeToString(trace[:16]),
+		SpanID:  hex.EncodeToString(span[:8]),
+		Name:    name,
+		Kind:    1, // internal
+		Start:   strconv.FormatInt(e.Begin.UnixNano(), 10),
+		End:     strconv.FormatInt(e.End.UnixNano(), 10),
+		Attributes: []otlpAttribute{
+			otlpString("track.tags", strings.Join(e.Tags, " ")),
+			{"track.billable", otlpValue{Bool: &billable}},
+		},
+	}
+	if e.Note != "" {
+		s.Attributes = append(s.Attributes, otlpString("track.note", e.Note))
+	}
+	return s
+}
+
+// otlpString returns a string attribute.
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{key, otlpValue{String: &value}}
+}
+
+// postOTLP sends req to the collector at endpoint.
+func postOTLP(endpoint string, req otlpRequest) error {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	for k, v := range configTable("otlp.headers") {
+		r.Header.Set(k, v)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("otlp: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// pauseMarker is the comment line that is appended to the times file when
+// the current session is paused. Since it is a comment, it is ignored when
+// the times are read, and it is removed again when the next entry begins.
+const pauseMarker = "# paused\n"
+
+// Pause completes the begun entry and marks the session as paused, so that
+// it can be continued with resume.
+func Pause() error {
+	f, err := os.OpenFile(pathArg, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	now := time.Now()
+	checkSkew(f, now)
+	if err = endEntry(f, true, now); err != nil {
+		return err
+	}
+
+	f.Seek(0, 2)
+	if _, err = f.WriteString(pauseMarker); err != nil {
+		return err
+	}
+	inform("PAUSE")
+	return nil
+}
+
+// Resume begins a new entry after a break, whether the session was paused
+// or the last entry was simply completed. The new entry has the same tags
+// and note as the last entry, unless the -tag or -note options are given.
+func Resume() error {
+	f, err := os.OpenFile(pathArg, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err = unpause(f); err != nil {
+		return err
+	}
+	f.Seek(0, 0)
+	last, _ := readEntries(f)
+	if last == nil {
+		return errors.New(tr("no previous entry to resume"))
+	}
+	if begun(last) {
+		return errors.New(tr("the last entry has not been completed yet"))
+	}
+	prev, err := parseEntry(last, 0)
+	if err != nil || !complete(last) {
+		return errors.New(tr("the last entry is invalid"))
+	}
+
+	now := time.Now()
+	e := newEntry(now)
+	if len(tagFlag) == 0 {
+		// -billable adds to the tags of the last entry rather than
+		// replacing them.
+		e.Tags = append([]string(nil), prev.Tags...)
+		if billableFlag && !e.Billable() {
+			e.Tags = append(e.Tags, billableTag)
+		}
+	}
+	if noteFlag == "" {
+		e.Note = prev.Note
+	}
+
+	checkSkew(f, now)
+	f.Seek(0, 0)
+	if err = beginEntry(f, failFlag, e); err != nil {
+		return err
+	}
+	inform("RESUME")
+	return nil
+}
+
+// unpause removes the pause marker from the end of f and returns true if
+// there was one. The offset of f is left undefined.
+func unpause(f *os.File) (bool, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	n := int64(len(pauseMarker))
+	if fi.Size() < n {
+		return false, nil
+	}
+
+	buf := make([]byte, n)
+	if _, err = f.ReadAt(buf, fi.Size()-n); err != nil && err != io.EOF {
+		return false, err
+	}
+	if !bytes.Equal(buf, []byte(pauseMarker)) {
+		return false, nil
+	}
+	return true, f.Truncate(fi.Size() - n)
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+)
+
+// stdio is the path that stands for standard input and output, so that
+// track can be used in pipelines like
+//
+//	ssh host cat TIMES.csv | track total -
+const stdio = "-"
+
+// stdin reads standard input, which the answers of the user are read from,
+// or the times file if it is stdio. Since it is buffered, the beginning of
+// the times file can be looked at before it is read.
+var stdin = bufio.NewReader(os.Stdin)
+
+// streaming tells which commands read the times file from standard input as
+// they go. The other commands read all of it into a temporary file first.
+var streaming = map[string]bool{
+	"export":      true,
+	"list":        true,
+	"report":      true,
+	"search":      true,
+	"stats":       true,
+	"timesheet":   true,
+	"total":       true,
+	"utilization": true,
+	"verify":      true,
+}
+
+// readOnly tells which of the commands that are not streaming never change
+// the times file, unless they are given the options that mutates checks.
+var readOnly = map[string]bool{
+	"dupes":  true,
+	"last":   true,
+	"status": true,
+}
+
+// lasting tells which commands change the times file long after they begin,
+// which standard input cannot be used for.
+var lasting = map[string]bool{
+	"for":   true,
+	"fork":  true,
+	"run":   true,
+	"until": true,
+	"wait":  true,
+}
+
+// mutates returns true if the command called name changes the times file
+// with the options that are given.
+func mutates(name string) bool {
+	switch name {
+	case "dupes":
+		return removeFlag
+	case "last":
+		return beginFlag != "" || endFlag != ""
+	}
+	return !streaming[name] && !readOnly[name]
+}
+
+// openTimes opens the times file at path for reading, which is standard
+// input for stdio.
+func openTimes(path string) (io.ReadCloser, error) {
+	if path == stdio {
+		return io.NopCloser(stdin), nil
+	}
+	return os.Open(path)
+}
+
+// pipeTimes prepares the command called name, which is not streaming, to
+// work on the times file from standard input: it is copied into a temporary
+// file, which pathArg is set to. If the command changes the file, what it
+// prints goes to standard error instead, so that standard output is left
+// for the changed file.
+//
+// Since standard input is used up, the user is asked questions, such as how
+// to resolve an overlap in clean, on the terminal instead.
+//
+// The returned function finishes the command with the error that it
+// returned: the changed file is written to standard output, unless there is
+// an error, and the temporary file is removed.
+func pipeTimes(name string) (func(error) error, error) {
+	if lasting[name] {
+		return nil, fmt.Errorf(tr("%s cannot use standard input as the times file"), name)
+	}
+	f, err := os.CreateTemp("", "track-*.csv")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, stdin)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+	pathArg, pathArgs = f.Name(), nil
+	if tty, err := openTerminal(); err == nil {
+		stdin = bufio.NewReader(tty)
+	}
+
+	stdout, write := os.Stdout, mutates(name)
+	if write {
+		os.Stdout = os.Stderr
+	}
+	return func(err error) error {
+		defer os.Remove(pathArg)
+		os.Stdout = stdout
+		if err != nil || !write {
+			return err
+		}
+		data, err := os.ReadFile(pathArg)
+		if err == nil {
+			_, err = os.Stdout.Write(data)
+		}
+		return err
+	}, nil
+}
+
+// openTerminal opens the terminal that track runs in for reading.
+func openTerminal() (*os.File, error) {
+	if runtime.GOOS == "windows" {
+		return os.Open("CONIN$")
+	}
+	return os.Open("/dev/tty")
+}
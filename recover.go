@@ -0,0 +1,213 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxJoin is the largest number of lines that a record is read from when
+// recovering a damaged times file, which limits how many lines a stray
+// quote can take with it.
+const maxJoin = 10
+
+// recoverTimes is like scanTimes for a damaged times file, as read with the
+// -recover option.
+//
+// Each record is read from its own line, so a stray quote or a line that was
+// cut off by a crash only loses that line rather than the rest of the file.
+// A line that leaves a quoted field open is joined with the lines after it if
+// that gives a valid entry, since notes may span several lines. Otherwise the
+// line is read as best it can, taking quotes that do not fit literally.
+// Every line that still does not give an entry is skipped, and the reason is
+// given in the *FormatError.
+func recoverTimes(r io.Reader, fn func(e *Entry) bool) error {
+	lines := &lineReader{r: bufio.NewReader(r), line: 1}
+	var (
+		e         Entry
+		formatErr FormatError
+	)
+	skip := func(line int, reason string) {
+		if formatErr.Reasons == nil {
+			formatErr.Reasons = make(map[int]string)
+		}
+		formatErr.BadLines = append(formatErr.BadLines, line)
+		formatErr.Reasons[line] = reason
+	}
+
+	// Like in scanTimes, the IDs count every record, even the skipped ones,
+	// so that an entry has the same ID with and without -recover.
+	for id := 0; ; {
+		text, ok := lines.peek(0)
+		if !ok {
+			break
+		}
+		line := lines.line
+		trimmed := strings.TrimSpace(strings.Trim(text, "\x00"))
+		if trimmed == "" || trimmed[0] == '#' {
+			if trimmed == "" && text != "" {
+				id++
+				skip(line, tr("only null bytes"))
+			}
+			lines.take(1)
+			continue
+		}
+		id++
+		formatErr.LastIsBad = false
+
+		record, n, err := recoverRecord(lines)
+		lines.take(n)
+		if err != nil {
+			skip(line, fmt.Sprintf("%v: %s", err, excerpt(text)))
+			continue
+		}
+		record = fromFile(record)
+		if !complete(record) {
+			if _, more := lines.peek(0); !more && begun(record) {
+				// The last entry may just not have ended yet.
+				formatErr.BadLines = append(formatErr.BadLines, line)
+				formatErr.LastIsBad = true
+			} else {
+				skip(line, fmt.Sprintf("%s: %s", tr("incomplete entry"), excerpt(text)))
+			}
+			continue
+		}
+		if err = e.parse(record, line); err != nil {
+			skip(line, fmt.Sprintf("%v: %s", err, excerpt(text)))
+			continue
+		}
+		e.ID = id
+		if !fn(&e) {
+			return nil
+		}
+	}
+	if lines.err != nil {
+		return lines.err
+	}
+	if formatErr.BadLines != nil {
+		return &formatErr
+	}
+	return nil
+}
+
+// recoverRecord reads the record at the start of lines, and returns it with
+// the number of lines that it was read from.
+func recoverRecord(lines *lineReader) ([]string, int, error) {
+	first, _ := lines.peek(0)
+	record, err := parseRecord(first, false)
+	if err == nil {
+		return record, 1, nil
+	}
+	if errors.Is(err, csv.ErrQuote) {
+		text := first
+		for n := 1; n < maxJoin; n++ {
+			next, ok := lines.peek(n)
+			if !ok || isEntry(next) {
+				break
+			}
+			text += "\n" + next
+			joined, err := parseRecord(text, false)
+			if err == nil {
+				if valid(joined) {
+					return joined, n + 1, nil
+				}
+				break
+			}
+			if !errors.Is(err, csv.ErrQuote) {
+				break
+			}
+		}
+	}
+	if record, lerr := parseRecord(first, true); lerr == nil {
+		return record, 1, nil
+	}
+	return nil, 1, err
+}
+
+// isEntry returns true if text is a line with a valid complete entry, which
+// cannot be the rest of a note from the lines before.
+func isEntry(text string) bool {
+	record, err := parseRecord(text, false)
+	return err == nil && valid(record)
+}
+
+// valid returns true if record is a valid complete entry.
+func valid(record []string) bool {
+	record = fromFile(record)
+	var e Entry
+	return complete(record) && e.parse(record, 0) == nil
+}
+
+// parseRecord parses text as a single record of the times file, which may
+// have quotes in the wrong places if lazy is true.
+func parseRecord(text string, lazy bool) ([]string, error) {
+	reader := newReader(strings.NewReader(text))
+	reader.LazyQuotes = lazy
+	record, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New(tr("empty record"))
+	} else if err != nil {
+		if perr, ok := err.(*csv.ParseError); ok {
+			err = perr.Err
+		}
+		return nil, err
+	}
+	if _, err = reader.Read(); err != io.EOF {
+		return nil, errors.New(tr("more than one record"))
+	}
+	return record, nil
+}
+
+// excerpt returns the beginning of the text of a damaged line, quoted so
+// that any control characters in it can be seen.
+func excerpt(text string) string {
+	const max = 40
+	if r := []rune(text); len(r) > max {
+		text = string(r[:max]) + "…"
+	}
+	return fmt.Sprintf("%q", text)
+}
+
+// A lineReader reads the lines of a file with some lookahead.
+type lineReader struct {
+	r     *bufio.Reader
+	ahead []string
+	line  int   // the number of the first line in ahead
+	eof   bool  // whether all of r has been read
+	err   error // the error that reading r failed with, if any
+}
+
+// peek returns the line i lines after the current one, and false if there is
+// no such line.
+func (l *lineReader) peek(i int) (string, bool) {
+	for len(l.ahead) <= i && !l.eof {
+		s, err := l.r.ReadString('\n')
+		if err != nil {
+			l.eof = true
+			if err != io.EOF {
+				l.err = err
+			}
+			if s == "" {
+				break
+			}
+		}
+		l.ahead = append(l.ahead, strings.TrimRight(s, "\r\n"))
+	}
+	if i < len(l.ahead) {
+		return l.ahead[i], true
+	}
+	return "", false
+}
+
+// take moves past n lines.
+func (l *lineReader) take(n int) {
+	l.ahead = l.ahead[n:]
+	l.line += n
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// recovered reads the times file in text with recoverTimes, and returns the
+// entries and the *FormatError, if any.
+func recovered(t testing.TB, text string) ([]Entry, *FormatError) {
+	var entries []Entry
+	err := recoverTimes(strings.NewReader(text), func(e *Entry) bool {
+		entries = append(entries, *e)
+		return true
+	})
+	if err == nil {
+		return entries, nil
+	}
+	var ferr *FormatError
+	if !errors.As(err, &ferr) {
+		t.Fatalf("recoverTimes(%q) = %v, want a *FormatError", text, err)
+	}
+	return entries, ferr
+}
+
+const (
+	recoverA = "2024-05-06 09:00:00 UTC,2024-05-06 10:00:00 UTC"
+	recoverB = "2024-05-06 11:00:00 UTC,2024-05-06 12:00:00 UTC"
+)
+
+func TestRecoverTimes(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		lines []int    // the lines of the entries
+		notes []string // the notes of the entries
+		ids   []int    // the IDs of the entries, if given
+		bad   []int    // the BadLines
+		last  bool     // the LastIsBad
+	}{
+		{
+			name:  "stray quote in note",
+			text:  recoverA + `,work,say "hi" there` + "\n" + recoverB + "\n",
+			lines: []int{1, 2},
+			notes: []string{`say "hi" there`, ""},
+		},
+		{
+			name:  "unclosed quote",
+			text:  recoverA + `,work,"cut off` + "\n" + recoverB + "\n",
+			lines: []int{1, 2},
+			notes: []string{"cut off", ""},
+		},
+		{
+			name:  "quote in time",
+			text:  `"2024-05-06 09:00:00 UTC,2024"-05-06 10:00:00 UTC` + "\n" + recoverB + "\n",
+			lines: []int{2},
+			notes: []string{""},
+			bad:   []int{1},
+		},
+		{
+			name:  "ragged rows",
+			text:  recoverA + ",work,note,extra,more\n2024-05-06 10:30:00 UTC\n" + recoverB + ",work\n",
+			lines: []int{3},
+			notes: []string{""},
+			bad:   []int{1, 2},
+		},
+		{
+			name:  "null lines",
+			text:  recoverA + "\n\x00\x00\x00\n\x00 \n" + recoverB + "\n",
+			lines: []int{1, 4},
+			notes: []string{"", ""},
+			bad:   []int{2, 3},
+		},
+		{
+			name:  "null bytes after a crash",
+			text:  recoverA + "\n2024-05-06 11:00:00 UTC,2024-05\x00\x00\x00\n" + recoverB + "\n",
+			lines: []int{1, 3},
+			notes: []string{"", ""},
+			bad:   []int{2},
+		},
+		{
+			name:  "multi-line note",
+			text:  recoverA + ",work,\"first\nsecond\nthird\"\n" + recoverB + "\n",
+			lines: []int{1, 4},
+			notes: []string{"first\nsecond\nthird", ""},
+		},
+		{
+			name:  "multi-line note that is never closed",
+			text:  recoverA + ",work,\"first\n" + recoverB + "\n",
+			lines: []int{1, 2},
+			notes: []string{"first", ""},
+		},
+		{
+			name:  "quote that joins no entry",
+			text:  recoverA + "\n,\"\n\"\n" + recoverB + "\n",
+			lines: []int{1, 4},
+			notes: []string{"", ""},
+			bad:   []int{2, 3},
+		},
+		{
+			name:  "damaged line before a valid one",
+			text:  recoverA + "\n2024-05-06 10:30:00 UTC,2024-05\n\n# comment\n" + recoverB + "\n",
+			lines: []int{1, 5},
+			notes: []string{"", ""},
+			ids:   []int{1, 3},
+			bad:   []int{2},
+		},
+		{
+			name:  "running entry at the end",
+			text:  recoverA + "\n2024-05-06 11:00:00 UTC\n",
+			lines: []int{1},
+			notes: []string{""},
+			bad:   []int{2},
+			last:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, ferr := recovered(t, tt.text)
+			var lines []int
+			var notes []string
+			var ids []int
+			for _, e := range entries {
+				lines = append(lines, e.Line)
+				notes = append(notes, e.Note)
+				ids = append(ids, e.ID)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) || !reflect.DeepEqual(notes, tt.notes) {
+				t.Errorf("entries on lines %v with notes %q, want %v with %q", lines, notes, tt.lines, tt.notes)
+			}
+			if tt.ids != nil && !reflect.DeepEqual(ids, tt.ids) {
+				t.Errorf("entries with IDs %v, want %v", ids, tt.ids)
+			}
+			var bad []int
+			var last bool
+			if ferr != nil {
+				bad, last = ferr.BadLines, ferr.LastIsBad
+				for _, line := range bad {
+					if _, ok := ferr.Reasons[line]; !ok && !(last && line == bad[len(bad)-1]) {
+						t.Errorf("no reason for bad line %d", line)
+					}
+				}
+			}
+			if !reflect.DeepEqual(bad, tt.bad) || last != tt.last {
+				t.Errorf("bad lines %v, last %v, want %v, last %v", bad, last, tt.bad, tt.last)
+			}
+		})
+	}
+}
+
+// FuzzRecoverTimes checks that recoverTimes does not panic, and that every
+// line of the file is accounted for: it is blank or a comment, an entry
+// begins on it, it is one of the BadLines, or it continues the note of the
+// entry before it.
+func FuzzRecoverTimes(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		recoverA + "\n" + recoverB + "\n",
+		recoverA + `,work,say "hi"` + "\n" + recoverB,
+		recoverA + ",work,\"first\nsecond\"\n" + recoverB + "\n",
+		recoverA + ",a,b,c,d\n\x00\x00\n# comment\n" + recoverB + "\r\n",
+		recoverA + "\n2024-05-06 11:00:00 UTC\n",
+		",\"\n\"",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, text string) {
+		entries, ferr := recovered(t, text)
+
+		covered := make(map[int]bool)
+		var begins []int
+		for _, e := range entries {
+			if covered[e.Line] {
+				t.Fatalf("two entries on line %d", e.Line)
+			}
+			covered[e.Line] = true
+			begins = append(begins, e.Line)
+		}
+		if ferr != nil {
+			for _, line := range ferr.BadLines {
+				if covered[line] {
+					t.Fatalf("line %d is both an entry and bad", line)
+				}
+				covered[line] = true
+			}
+		}
+
+		var lines []string
+		if text != "" {
+			lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+		}
+		for i, s := range lines {
+			line := i + 1
+			trimmed := strings.TrimSpace(strings.Trim(strings.TrimRight(s, "\r"), "\x00"))
+			if covered[line] || trimmed == "" || trimmed[0] == '#' {
+				continue
+			}
+			// The entry that begins closest before the line must not be
+			// further away than a record can be joined over, with nothing
+			// else in between.
+			j := sort.SearchInts(begins, line) - 1
+			if j < 0 || line-begins[j] >= maxJoin {
+				t.Fatalf("line %d is neither emitted nor bad: %q", line, s)
+			}
+			for k := begins[j] + 1; k < line; k++ {
+				if covered[k] {
+					t.Fatalf("line %d is neither emitted nor bad: %q", line, s)
+				}
+			}
+		}
+	})
+}
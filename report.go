@@ -0,0 +1,330 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// tagSep separates the levels of a hierarchical tag, such as client:project.
+const tagSep = ":"
+
+// untagged is the group that entries without any tags are reported in.
+const untagged = "(untagged)"
+
+// ancestors returns tag and all the tags above it in the hierarchy, with
+// the topmost tag first.
+func ancestors(tag string) []string {
+	parts := strings.Split(tag, tagSep)
+	tags := make([]string, len(parts))
+	for i := range parts {
+		tags[i] = strings.Join(parts[:i+1], tagSep)
+	}
+	return tags
+}
+
+// specificTag returns the most specific tag of e, or ancestor of such a tag,
+// for which ok returns true. If there is none, it returns "".
+func specificTag(e *Entry, ok func(tag string) bool) string {
+	var best string
+	depth := 0
+	for _, t := range e.Tags {
+		as := ancestors(t)
+		for i := len(as) - 1; i >= 0 && i+1 > depth; i-- {
+			if ok(as[i]) {
+				best, depth = as[i], i+1
+				break
+			}
+		}
+	}
+	return best
+}
+
+// Report prints the total time of the entries that match the filter options,
+// grouped according to the -group-by option: by tag, by day, or by the times
+// file that the entries were read from.
+//
+// When grouping by tag, every level of a hierarchical tag gets a subtotal,
+// so the time spent on client:project:task also counts towards
+// client:project and client. An entry with several tags counts towards each
+// of them, so the groups can add up to more than the total.
+//
+// If durations are rounded with the -round option or the configuration,
+// both the raw and the rounded durations are printed. If hourly rates are
+// configured, the amount earned with the rounded durations of the billable
+// entries is printed. If monthly budgets are configured, tags with a budget
+// show it for the months of the report, along with how much of it was used.
+// With the -slot option or the configuration, the entries of all the files
+// are snapped to a grid of slots before they are filtered and added up; see
+// loadSlots and snap.
+// Durations and days are written as is usual in the configured locale.
+func Report() error {
+	match, err := entryFilter()
+	if err != nil {
+		return err
+	}
+	rates, err := loadRates()
+	if err != nil {
+		return err
+	}
+	money, err := loadMoneyFormat()
+	if err != nil {
+		return err
+	}
+
+	var groups func(e *Entry) []string
+	switch groupByFlag {
+	case "tag":
+		groups = func(e *Entry) []string {
+			var tags []string
+			seen := make(map[string]bool)
+			for _, t := range e.Tags {
+				if t == billableTag {
+					continue
+				}
+				for _, a := range ancestors(t) {
+					if !seen[a] {
+						seen[a] = true
+						tags = append(tags, a)
+					}
+				}
+			}
+			if len(tags) == 0 {
+				return []string{untagged}
+			}
+			return tags
+		}
+	case "day":
+		groups = func(e *Entry) []string {
+			return []string{e.Begin.Format(dateFormat)}
+		}
+	case "file":
+		groups = func(e *Entry) []string {
+			if e.File == "" {
+				return []string{pathArg}
+			}
+			return []string{e.File}
+		}
+	default:
+		return fmt.Errorf(tr("cannot group by %q"), groupByFlag)
+	}
+
+	round, err := loadRounding()
+	if err != nil {
+		return err
+	}
+	budgets, err := loadBudgets()
+	if err != nil {
+		return err
+	}
+	if groupByFlag != "tag" {
+		budgets = nil
+	}
+	grid, err := loadSlots()
+	if err != nil {
+		return err
+	}
+
+	var (
+		groupRaw   = make(map[string]time.Duration)
+		groupRound = make(map[string]time.Duration)
+		amounts    = make(map[string]float64)
+		first      time.Time
+		last       time.Time
+	)
+	paths, err := filePaths()
+	if err != nil {
+		return err
+	}
+	totals := make([]reportTotals, len(paths))
+	for i := range totals {
+		totals[i] = newReportTotals()
+	}
+	add := func(i int, e *Entry) {
+		t := &totals[i]
+		if t.first.IsZero() || e.Begin.Before(t.first) {
+			t.first = e.Begin
+		}
+		if e.Begin.After(t.last) {
+			t.last = e.Begin
+		}
+		raw, rounded := e.Duration(), e.Duration()
+		if round != nil {
+			rounded = round.Round(raw)
+		}
+		var amount float64
+		if rates != nil && e.Billable() {
+			amount = rates.Rate(e) * rounded.Hours()
+		}
+		for _, g := range append(groups(e), "") {
+			t.raw[g] += raw
+			t.round[g] += rounded
+			t.amounts[g] += amount
+		}
+	}
+	snapped := make([][]Entry, len(paths))
+	err = scanFiles(paths, func(i int, e *Entry) bool {
+		if grid != nil {
+			snapped[i] = append(snapped[i], *e)
+		} else if match(e) {
+			add(i, e)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if grid != nil {
+		// The slots are shared by all the files, so the entries are
+		// snapped together, in the order of the files.
+		var entries []Entry
+		for _, es := range snapped {
+			entries = append(entries, es...)
+		}
+		for _, e := range grid.snap(entries) {
+			if match(&e) {
+				add(0, &e)
+			}
+		}
+	}
+
+	// The files are merged in order, since adding up the amounts in another
+	// order could change them in the last digits.
+	for _, t := range totals {
+		if !t.first.IsZero() && (first.IsZero() || t.first.Before(first)) {
+			first = t.first
+		}
+		if t.last.After(last) {
+			last = t.last
+		}
+		for g, d := range t.raw {
+			groupRaw[g] += d
+			groupRound[g] += t.round[g]
+			amounts[g] += t.amounts[g]
+		}
+	}
+
+	keys := make([]string, 0, len(groupRaw))
+	for k := range groupRaw {
+		if k != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i] == untagged || keys[j] == untagged {
+			return keys[j] == untagged && keys[i] != untagged
+		}
+		return lessTag(keys[i], keys[j])
+	})
+
+	// The budgets are for the months from the first day to the last day of
+	// the report.
+	if fromFlag != "" {
+		first, _ = time.ParseInLocation(dateFormat, fromFlag, time.Local)
+	}
+	if toFlag != "" {
+		last, _ = time.ParseInLocation(dateFormat, toFlag, time.Local)
+	}
+	months := time.Duration(1)
+	if !first.IsZero() && !last.IsZero() && !last.Before(first) {
+		months = time.Duration(monthsBetween(first, last))
+	}
+
+	// When durations are rounded, the raw durations are shown next to the
+	// rounded ones, so that the effect of rounding can be checked.
+	// Rows without a budget leave its cells empty, and the spaces that they
+	// are padded with are trimmed from the end of the lines.
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	row := func(name, k string) {
+		if k == untagged {
+			name = tr(untagged)
+		}
+		cells := []string{name, formatDuration(groupRaw[k])}
+		if round != nil {
+			cells = append(cells, formatDuration(groupRound[k]))
+		}
+		if rates != nil {
+			cells = append(cells, money.Format(amounts[k]))
+		}
+		if b, ok := budgets[k]; ok {
+			b *= months
+			cells = append(cells, formatDuration(b), fmt.Sprintf("%d%%", percentOf(groupRaw[k], b)))
+		} else if budgets != nil {
+			cells = append(cells, "", "")
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	if round != nil || rates != nil || budgets != nil {
+		header := []string{"", tr("raw")}
+		if round != nil {
+			header = append(header, tr("rounded"))
+		}
+		if rates != nil {
+			header = append(header, tr("amount"))
+		}
+		if budgets != nil {
+			header = append(header, tr("budget"), tr("used"))
+		}
+		fmt.Fprintln(w, strings.Join(header, "\t"))
+	}
+	for _, k := range keys {
+		name := k
+		if groupByFlag == "tag" && k != untagged {
+			depth := strings.Count(k, tagSep)
+			name = strings.Repeat("  ", depth) + k[strings.LastIndex(k, tagSep)+1:]
+		} else if groupByFlag == "day" {
+			day, _ := time.Parse(dateFormat, k)
+			name = formatDate(day)
+		}
+		row(name, k)
+	}
+	row(tr("total"), "")
+	if round != nil {
+		fmt.Fprintf(w, "%s\t\t%s\n", tr("difference"), signed(groupRound[""]-groupRaw[""]))
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line != "" {
+			fmt.Println(strings.TrimRight(line, " \n"))
+		}
+	}
+	return nil
+}
+
+// lessTag orders hierarchical tags so that every tag directly follows its
+// parent, and tags with the same parent are in alphabetical order.
+func lessTag(a, b string) bool {
+	as, bs := strings.Split(a, tagSep), strings.Split(b, tagSep)
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// reportTotals are the totals of the groups of a report in one times file.
+type reportTotals struct {
+	raw, round  map[string]time.Duration
+	amounts     map[string]float64
+	first, last time.Time
+}
+
+// newReportTotals returns the totals of a file without any entries.
+func newReportTotals() reportTotals {
+	return reportTotals{
+		raw:     make(map[string]time.Duration),
+		round:   make(map[string]time.Duration),
+		amounts: make(map[string]float64),
+	}
+}
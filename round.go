@@ -0,0 +1,66 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// A rounding rounds the duration of each entry to a multiple of a unit,
+// as is common when billing time.
+type rounding struct {
+	unit time.Duration
+	mode string // up, down, or nearest
+}
+
+// loadRounding returns the rounding given by the -round option, or else by
+// the configuration, or nil if durations are not rounded:
+//
+//	round = "15m"
+//	round-mode = "up" # or "down" or "nearest"
+func loadRounding() (*rounding, error) {
+	r := &rounding{unit: roundFlag, mode: "up"}
+	if v, ok := config["round"]; ok && r.unit == 0 {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("config: round: %v", err)
+		}
+		r.unit = d
+	}
+	if r.unit <= 0 {
+		return nil, nil
+	}
+	if v, ok := config["round-mode"]; ok {
+		r.mode = v
+	}
+	switch r.mode {
+	case "up", "down", "nearest":
+		return r, nil
+	}
+	return nil, fmt.Errorf(tr("config: unknown round-mode %q"), r.mode)
+}
+
+// Round returns d rounded to a multiple of the unit.
+func (r *rounding) Round(d time.Duration) time.Duration {
+	switch r.mode {
+	case "down":
+		return d.Truncate(r.unit)
+	case "nearest":
+		return d.Round(r.unit)
+	}
+	if t := d.Truncate(r.unit); t != d {
+		return t + r.unit
+	}
+	return d
+}
+
+// signed formats d with an explicit sign, as when it is a difference.
+func signed(d time.Duration) string {
+	if d < 0 {
+		return formatDuration(d)
+	}
+	return "+" + formatDuration(d)
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// A schedule is the time that is to be worked on each day of the week, except
+// on holidays.
+type schedule struct {
+	week     [7]time.Duration // indexed by time.Weekday
+	holidays map[string]bool  // the dates of the holidays, in dateFormat
+}
+
+// loadSchedule returns the schedule in the table [schedule] of the
+// configuration, which gives the time to work on each day of the week that
+// is worked on:
+//
+//	[schedule]
+//	monday = "8h"
+//	tuesday = "8h"
+//	wednesday = "8h"
+//	thursday = "8h"
+//	friday = "4h"
+//
+// Without the table, the key daily-goal is worked from Monday to Friday,
+// or 8 hours if it is not given either.
+//
+// Nothing is to be worked on the holidays, which are given by the keys
+//
+//	holidays = "2024-12-24 2024-12-25 2024-12-26"
+//	holiday-file = "holidays.ics"
+//
+// The file is either an iCalendar file, in which the day that each event
+// begins is a holiday, or a text file with one date on each line, which may
+// be followed by the name of the holiday. Lines beginning with # are
+// comments.
+func loadSchedule() (schedule, error) {
+	var s schedule
+	holidays, err := loadHolidays()
+	if err != nil {
+		return s, err
+	}
+	s.holidays = holidays
+
+	table := configTable("schedule")
+	if len(table) == 0 {
+		goal, err := configDuration("daily-goal")
+		if err != nil {
+			return s, err
+		}
+		if goal == 0 {
+			goal = 8 * time.Hour
+		}
+		for d := time.Monday; d <= time.Friday; d++ {
+			s.week[d] = goal
+		}
+		return s, nil
+	}
+
+	for k := range table {
+		day, ok := weekdayNamed(k)
+		if !ok {
+			return s, fmt.Errorf(tr("config: schedule.%s is not a day of the week"), k)
+		}
+		d, err := configDuration("schedule." + k)
+		if err != nil {
+			return s, err
+		}
+		s.week[day] = d
+	}
+	return s, nil
+}
+
+// loadHolidays returns the dates of the holidays that are given by the keys
+// holidays and holiday-file in the configuration.
+func loadHolidays() (map[string]bool, error) {
+	holidays := make(map[string]bool)
+	for _, date := range strings.Fields(config["holidays"]) {
+		if _, err := time.Parse(dateFormat, date); err != nil {
+			return nil, fmt.Errorf(tr("config: holidays: %q is not a date"), date)
+		}
+		holidays[date] = true
+	}
+	path := config["holiday-file"]
+	if path == "" {
+		return holidays, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	calendar := false
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if n == 1 && line == "BEGIN:VCALENDAR" {
+			calendar = true
+		}
+		if calendar {
+			// An all-day event begins with a line like
+			// DTSTART;VALUE=DATE:20241225.
+			if !strings.HasPrefix(line, "DTSTART") {
+				continue
+			}
+			i := strings.LastIndexByte(line, ':')
+			if i < 0 || len(line) < i+9 {
+				return nil, fmt.Errorf(tr("%s:%d: invalid start of an event"), path, n)
+			}
+			t, err := time.Parse("20060102", line[i+1:i+9])
+			if err != nil {
+				return nil, fmt.Errorf(tr("%s:%d: invalid start of an event"), path, n)
+			}
+			holidays[t.Format(dateFormat)] = true
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		date := strings.Fields(line)[0]
+		if _, err := time.Parse(dateFormat, date); err != nil {
+			return nil, fmt.Errorf(tr("%s:%d: %q is not a date"), path, n, date)
+		}
+		holidays[date] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return holidays, nil
+}
+
+// weekdayNamed returns the day of the week with the given English name.
+func weekdayNamed(name string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(name, d.String()) {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// on returns the time to work on the day of t, which is nothing on a
+// holiday.
+func (s *schedule) on(t time.Time) time.Duration {
+	if s.holidays[t.Format(dateFormat)] {
+		return 0
+	}
+	return s.week[t.Weekday()]
+}
+
+// between returns the time to work on the days from the day of from up to
+// but not including the day of to, and on how many of them there is work.
+func (s *schedule) between(from, to time.Time) (sum time.Duration, days int) {
+	for day := startOfDay(from); day.Before(startOfDay(to)); day = day.AddDate(0, 0, 1) {
+		if d := s.on(day); d > 0 {
+			sum += d
+			days++
+		}
+	}
+	return sum, days
+}
+
+// startOfDay returns midnight at the beginning of the day of t.
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek returns midnight at the beginning of the Monday of the week
+// of t.
+func startOfWeek(t time.Time) time.Time {
+	day := startOfDay(t)
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+// startOfMonth returns midnight at the beginning of the month of t.
+func startOfMonth(t time.Time) time.Time {
+	y, m, _ := t.Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Search lists the entries whose tags or note contain the pattern that is
+// given as argument, and which match the filter options as for list.
+//
+// The pattern is matched as a substring regardless of case, or as a regular
+// expression if the -regexp option is given.
+func Search() error {
+	contains := func(s string) bool {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(cmdArgs[0]))
+	}
+	if regexpFlag {
+		re, err := regexp.Compile(cmdArgs[0])
+		if err != nil {
+			return err
+		}
+		contains = re.MatchString
+	}
+
+	match, err := entryFilter()
+	if err != nil {
+		return err
+	}
+
+	return scanFile(pathArg, func(e *Entry) bool {
+		if !match(e) {
+			return true
+		}
+		found := contains(e.Note)
+		for _, t := range e.Tags {
+			found = found || contains(t)
+		}
+		if found {
+			printEntry(e)
+		}
+		return true
+	})
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// sessionPath returns the path of the file that records the process that
+// waits to complete the begun entry in the times file at path.
+//
+// The file serves as a heartbeat for watchdogs and other scripts: as long as
+// the process waits, it rewrites the file every suspendCheck with lines like
+//
+//	pid: 4242
+//	begin: 2024-05-01 09:00:00 CEST
+//	tags: clientA billable
+//	seen: 2024-05-01 11:30:00 CEST
+//
+// so that a file that was not modified for longer means that the process
+// died and time is being lost. The file is removed when the entry ends.
+func sessionPath(path string) string {
+	return path + ".wait"
+}
+
+// startSession records that this process waits for the begun entry in the
+// times file at path.
+func startSession(path string) error {
+	return beatSession(path, time.Now())
+}
+
+// beatSession rewrites the file that records that this process waits for
+// the begun entry in the times file at path, as seen at now.
+func beatSession(path string, now time.Time) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "pid: %d\n", os.Getpid())
+	if data, err := os.ReadFile(path); err == nil {
+		if e, err := runningEntry(data); err == nil && e != nil {
+			fmt.Fprintf(&buf, "begin: %s\n", e.Begin.Format(timeFormat))
+			fmt.Fprintf(&buf, "tags: %s\n", strings.Join(e.Tags, " "))
+		}
+	}
+	fmt.Fprintf(&buf, "seen: %s\n", now.Format(timeFormat))
+	return os.WriteFile(sessionPath(path), buf.Bytes(), 0666)
+}
+
+// sessionPID returns the process ID recorded in the session file data.
+func sessionPID(data []byte) (int, error) {
+	for _, line := range strings.Split(string(data), "\n") {
+		if s := strings.TrimPrefix(line, "pid:"); s != line {
+			return strconv.Atoi(strings.TrimSpace(s))
+		}
+	}
+	return 0, errors.New(tr("no pid in session file"))
+}
+
+// endSession removes the record that this process waits for the begun entry
+// in the times file at path.
+func endSession(path string) {
+	os.Remove(sessionPath(path))
+}
+
+// checkSession looks for a process that was waiting for the begun entry in
+// the times file at path, but died, perhaps because the machine crashed.
+// In that case the user is warned, and if repair is true, the gap is
+// recorded in a comment before the begun entry, since the entry will not be
+// completed when it should have been, and the session file is removed.
+// Commands that only read the times file do not repair it, so that reading
+// it never changes it.
+func checkSession(path string, repair bool) error {
+	spath := sessionPath(path)
+	data, err := os.ReadFile(spath)
+	if err != nil {
+		return nil
+	}
+	pid, err := sessionPID(data)
+	if err == nil && processAlive(pid) {
+		return nil
+	}
+	var seen time.Time
+	if fi, err := os.Stat(spath); err == nil {
+		seen = fi.ModTime()
+	}
+
+	flags := os.O_RDONLY
+	if repair {
+		flags = os.O_RDWR
+	}
+	f, err := os.OpenFile(path, flags, 0666)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	data, err = io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	last, _, _, err := lastRecord(data)
+	if err != nil {
+		return err
+	}
+	if last == nil || !begun(last) {
+		if repair {
+			return os.Remove(spath)
+		}
+		return nil
+	}
+	seenAt := seen.Format(timeFormat)
+	warn("the wait process for the begun entry died, and was last seen at %s", seenAt)
+	if !repair {
+		return nil
+	}
+	if err = os.Remove(spath); err != nil {
+		return err
+	}
+	return markLast(f, fmt.Sprintf("wait died; last seen at %s", seenAt))
+}
+
+// processAlive returns true if the process with the given ID is running.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// Finding a process only succeeds if it is running.
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+// markLast adds a comment line with each of notes before the last record in
+// f, which explains what happened to the entry.
+func markLast(f *os.File, notes ...string) error {
+	f.Seek(0, 0)
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	last, begin, _, err := lastRecord(data)
+	if err != nil {
+		return err
+	}
+	if last == nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, note := range notes {
+		fmt.Fprintf(&buf, "# %s\n", note)
+	}
+	buf.Write(data[begin:])
+	_, err = f.WriteAt(buf.Bytes(), begin)
+	return err
+}
@@ -0,0 +1,33 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// sleepMeasured tells whether asleep knows how long the machine was
+// suspended. Linux counts it in CLOCK_BOOTTIME, but not in CLOCK_MONOTONIC,
+// which the monotonic clock of Go reads.
+const sleepMeasured = true
+
+const (
+	clockMonotonic = 1
+	clockBoottime  = 7
+)
+
+// asleep returns how long the machine was suspended since it booted.
+func asleep() (time.Duration, bool) {
+	var boot, mono syscall.Timespec
+	if _, _, e := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, clockBoottime, uintptr(unsafe.Pointer(&boot)), 0); e != 0 {
+		return 0, false
+	}
+	if _, _, e := syscall.Syscall(syscall.SYS_CLOCK_GETTIME, clockMonotonic, uintptr(unsafe.Pointer(&mono)), 0); e != 0 {
+		return 0, false
+	}
+	return time.Duration(boot.Nano() - mono.Nano()), true
+}
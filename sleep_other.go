@@ -0,0 +1,19 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+//go:build !linux
+
+package main
+
+import "time"
+
+// sleepMeasured tells whether asleep knows how long the machine was
+// suspended, which it does not on this system.
+const sleepMeasured = false
+
+// asleep returns how long the machine was suspended since it booted, which
+// is not known on this system.
+func asleep() (time.Duration, bool) {
+	return 0, false
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// A slotGrid divides each day into slots of the same size, as in the
+// timesheets of employers that only take bookings of whole slots.
+type slotGrid struct {
+	size   time.Duration
+	offset time.Duration // where the slots begin after midnight
+}
+
+// loadSlots returns the grid given by the -slot option, or else by the
+// configuration, or nil if entries are not snapped to slots:
+//
+//	slot = "30m"
+//	slot-offset = "15m" # slots begin at a quarter past the hour
+//
+// The size of the slots must divide a day evenly, so that every day has the
+// same slots, which begin on the hour unless an offset is given.
+func loadSlots() (*slotGrid, error) {
+	g := &slotGrid{size: slotFlag}
+	if v, ok := config["slot"]; ok && g.size == 0 {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("config: slot: %v", err)
+		}
+		g.size = d
+	}
+	if g.size <= 0 {
+		return nil, nil
+	}
+	if 24*time.Hour%g.size != 0 {
+		return nil, fmt.Errorf(tr("slots of %s do not divide a day evenly"), g.size)
+	}
+	offset, err := configDuration("slot-offset")
+	if err != nil {
+		return nil, err
+	}
+	g.offset = (offset%g.size + g.size) % g.size
+	return g, nil
+}
+
+// floor returns the beginning of the slot that t is in.
+func (g *slotGrid) floor(t time.Time) time.Time {
+	base := startOfDay(t).Add(g.offset)
+	if t.Before(base) {
+		base = base.Add(-g.size)
+	}
+	return base.Add(t.Sub(base).Truncate(g.size))
+}
+
+// A slotClaim is how much of a slot is covered by entries, and which entry
+// covers the most of it.
+type slotClaim struct {
+	covered time.Duration // of the union of the entries in the slot
+	reach   time.Time     // the latest end of the entries in the slot
+	most    time.Duration
+	owner   int
+}
+
+// snap returns the entries with their boundaries moved to the slots of the
+// grid, in chronological order. A slot is booked if entries cover at least
+// half of it together, where time that several entries cover only counts
+// once, and then belongs to the entry that covers the most of it, or
+// to the one that begins first if several cover as much. Each entry becomes
+// the runs of slots that belong to it, so an entry can be left out, if it
+// covers less than half of a slot, or split, if another entry takes a slot
+// in the middle of it. This keeps the total close to the time that was
+// tracked, and snapping the same entries always gives the same result.
+//
+// Entries that have not been completed are left as they are.
+func (g *slotGrid) snap(entries []Entry) []Entry {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Begin.Before(entries[j].Begin)
+	})
+	claims := make(map[int64]*slotClaim)
+	var slots []time.Time
+	var snapped []Entry
+	for i, e := range entries {
+		if e.End.IsZero() {
+			snapped = append(snapped, e)
+			continue
+		}
+		for s := g.floor(e.Begin); s.Before(e.End); s = s.Add(g.size) {
+			begin, end := s, s.Add(g.size)
+			if e.Begin.After(begin) {
+				begin = e.Begin
+			}
+			if e.End.Before(end) {
+				end = e.End
+			}
+			c := claims[s.UnixNano()]
+			if c == nil {
+				c = &slotClaim{owner: i}
+				claims[s.UnixNano()] = c
+				slots = append(slots, s)
+			}
+			// The entries are in order of their beginning, so only the
+			// part after the entries before adds to the union.
+			from := begin
+			if c.reach.After(from) {
+				from = c.reach
+			}
+			if end.After(from) {
+				c.covered += end.Sub(from)
+				c.reach = end
+			}
+			if end.Sub(begin) > c.most {
+				c.most, c.owner = end.Sub(begin), i
+			}
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Before(slots[j]) })
+
+	// last is the index in snapped of the latest run of each entry.
+	last := make(map[int]int)
+	for _, s := range slots {
+		c := claims[s.UnixNano()]
+		if 2*c.covered < g.size {
+			continue
+		}
+		if j, ok := last[c.owner]; ok && snapped[j].End.Equal(s) {
+			snapped[j].End = s.Add(g.size)
+			continue
+		}
+		e := entries[c.owner]
+		e.Begin, e.End = s, s.Add(g.size)
+		last[c.owner] = len(snapped)
+		snapped = append(snapped, e)
+	}
+	sort.SliceStable(snapped, func(i, j int) bool {
+		return snapped[i].Begin.Before(snapped[j].Begin)
+	})
+	return snapped
+}
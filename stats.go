@@ -0,0 +1,170 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// A period is a span of days that stats are given for, from start up to but
+// not including end.
+type period struct {
+	name       string
+	start, end time.Time
+	goalKey    string // the key of the goal in the configuration
+}
+
+// Stats prints the time that was tracked in the current week and month, for
+// the entries that match the filter options, with the time that the
+// schedule plans up to today and the average on each working day so far.
+// A running entry counts up to now.
+//
+// With the -forecast option, the totals at the end of the week and the
+// month are projected at the pace so far: the time tracked so far grows in
+// proportion to the time that the schedule plans for the rest of the
+// period. The time that has to be tracked on each remaining working day to
+// reach the goal is printed as well. Since the time of today has not all
+// been tracked yet, today counts among the remaining days, and the pace is
+// that of the days before; see forecast. The goals are given by the keys
+//
+//	weekly-goal = "40h"
+//	monthly-goal = "160h"
+//
+// in the configuration, and otherwise are all the time that the schedule
+// plans for the period. See loadSchedule for the schedule.
+func Stats() error {
+	match, err := entryFilter()
+	if err != nil {
+		return err
+	}
+	sched, err := loadSchedule()
+	if err != nil {
+		return err
+	}
+	paths, err := filePaths()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	today := startOfDay(now)
+	tomorrow := today.AddDate(0, 0, 1)
+	periods := []period{
+		{tr("week"), startOfWeek(now), startOfWeek(now).AddDate(0, 0, 7), "weekly-goal"},
+		{tr("month"), startOfMonth(now), startOfMonth(now).AddDate(0, 1, 0), "monthly-goal"},
+	}
+	// before is the part of tracked that was tracked before today.
+	tracked := make([][]time.Duration, len(paths))
+	before := make([][]time.Duration, len(paths))
+	for i := range tracked {
+		tracked[i] = make([]time.Duration, len(periods))
+		before[i] = make([]time.Duration, len(periods))
+	}
+	add := func(i int, e *Entry) {
+		if !match(e) {
+			return
+		}
+		for j, p := range periods {
+			if !e.Begin.Before(p.start) && e.Begin.Before(p.end) {
+				tracked[i][j] += e.Duration()
+				if e.Begin.Before(today) {
+					before[i][j] += e.Duration()
+				}
+			}
+		}
+	}
+	err = scanFiles(paths, func(i int, e *Entry) bool {
+		add(i, e)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for i, path := range paths {
+		running, err := runningIn(path)
+		if err != nil {
+			return err
+		}
+		if running != nil && running.Begin.Before(now) {
+			running.End = now.Truncate(time.Second)
+			add(i, running)
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "\t%s\t%s\t%s", tr("tracked"), tr("scheduled"), tr("per day"))
+	if forecastFlag {
+		fmt.Fprintf(w, "\t%s\t%s\t%s", tr("forecast"), tr("goal"), tr("needed per day"))
+	}
+	fmt.Fprintln(w)
+	for j, p := range periods {
+		var sum, earlier time.Duration
+		for i := range paths {
+			sum += tracked[i][j]
+			earlier += before[i][j]
+		}
+		planned, days := sched.between(p.start, tomorrow)
+		var average time.Duration
+		if days > 0 {
+			average = (sum / time.Duration(days)).Round(time.Minute)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s", p.name, formatDuration(sum), formatDuration(planned),
+			formatDuration(average))
+
+		if forecastFlag {
+			_, daysLeft := sched.between(today, p.end)
+			goal, err := configDuration(p.goalKey)
+			if err != nil {
+				return err
+			}
+			if goal == 0 {
+				goal, _ = sched.between(p.start, p.end)
+			}
+			projected := forecast(&sched, p, now, sum, earlier)
+			needed := "-"
+			if daysLeft > 0 && goal > sum {
+				needed = formatDuration(((goal - sum) / time.Duration(daysLeft)).Round(time.Minute))
+			} else if goal <= sum {
+				needed = formatDuration(0)
+			}
+			fmt.Fprintf(w, "\t%s\t%s\t%s", formatDuration(projected.Round(time.Minute)), formatDuration(goal), needed)
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+// forecast projects the time that is tracked in p by its end, given the time
+// sum that is tracked up to now, of which earlier was tracked before today.
+// The days after today add the time that the schedule plans for them at the
+// pace of the days before today, which is how much of the time the schedule
+// planned for them was tracked. Today only counts with the time tracked so
+// far, which keeps it from counting twice.
+func forecast(sched *schedule, p period, now time.Time, sum, earlier time.Duration) time.Duration {
+	today := startOfDay(now)
+	past, _ := sched.between(p.start, today)
+	later, _ := sched.between(today.AddDate(0, 0, 1), p.end)
+	if past <= 0 {
+		return sum
+	}
+	return sum + time.Duration(float64(earlier)*float64(later)/float64(past))
+}
+
+// runningIn returns the begun entry at the end of the times file at path, or
+// nil if there is none. Standard input cannot be read again after its
+// entries, so it has none.
+func runningIn(path string) (*Entry, error) {
+	if path == stdio {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return runningEntry(data)
+}
@@ -0,0 +1,45 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestForecast(t *testing.T) {
+	h := time.Hour
+	sched := schedule{week: [7]time.Duration{0, 8 * h, 8 * h, 8 * h, 8 * h, 8 * h, 0}}
+	monday := time.Date(2024, time.May, 6, 0, 0, 0, 0, time.UTC)
+	week := period{"week", monday, monday.AddDate(0, 0, 7), "weekly-goal"}
+	at := func(day, hour int) time.Time {
+		return monday.AddDate(0, 0, day).Add(time.Duration(hour) * h)
+	}
+	tests := []struct {
+		name         string
+		now          time.Time
+		sum, earlier time.Duration
+		want         time.Duration
+	}{
+		// Wednesday after three full days, with today done too.
+		{"full days", at(2, 18), 24 * h, 16 * h, 40 * h},
+		// Wednesday at noon, with half of today tracked.
+		{"mid-day", at(2, 12), 20 * h, 16 * h, 36 * h},
+		// Wednesday at noon, at half the pace on the days before.
+		{"slow pace", at(2, 12), 12 * h, 8 * h, 20 * h},
+		// Nothing is known about the pace on the first day.
+		{"first day", at(0, 12), 4 * h, 0, 4 * h},
+		// The days after today are the weekend.
+		{"friday", at(4, 12), 36 * h, 32 * h, 36 * h},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forecast(&sched, week, tt.now, tt.sum, tt.earlier); got != tt.want {
+				t.Errorf("forecast at %s with %s tracked, %s before today = %s, want %s",
+					tt.now.Format(timeFormat), tt.sum, tt.earlier, got, tt.want)
+			}
+		})
+	}
+}
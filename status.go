@@ -0,0 +1,149 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// barWidth is the number of characters in the progress bar of status.
+const barWidth = 20
+
+// Status shows whether an entry is running and how much time has been spent
+// today. If the key daily-goal in the configuration gives the time that
+// should be spent each day, such as
+//
+//	daily-goal = "7h30m"
+//
+// then a progress bar shows how much of it has been done, counting the
+// running entry up to now. A warning is given for each tag that has used
+// most of its monthly budget. The status is also published over MQTT if
+// that is configured with the key mqtt.status.
+func Status() error {
+	goal, err := configDuration("daily-goal")
+	if err != nil {
+		return err
+	}
+	budgets, err := loadBudgets()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(pathArg)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	entries, err := readTimes(bytes.NewReader(data))
+	if err != nil {
+		ferr, ok := err.(*FormatError)
+		if !ok {
+			return err
+		}
+		if !ferr.JustIncomplete() {
+			warn("%s", ferr)
+		}
+	}
+	running, err := runningEntry(data)
+	if err != nil {
+		return err
+	}
+
+	publishEvent("status", running)
+
+	now := time.Now()
+	switch {
+	case running != nil:
+		line := fmt.Sprintf(tr("tracking since %s (%s)"), running.Begin.Format("15:04"),
+			formatDuration(now.Sub(running.Begin).Round(time.Second)))
+		if len(running.Tags) > 0 {
+			line += "  " + strings.Join(running.Tags, " ")
+		}
+		if running.Note != "" {
+			line += "  " + running.Note
+		}
+		fmt.Println(line)
+	case bytes.HasSuffix(data, []byte(pauseMarker)) && len(entries) > 0:
+		fmt.Printf(tr("paused since %s")+"\n", entries[len(entries)-1].End.Format("15:04"))
+	default:
+		fmt.Println(tr("not tracking"))
+	}
+
+	done := spentToday(entries, running, now)
+	if goal <= 0 {
+		fmt.Printf(tr("today: %s")+"\n", formatDuration(done))
+	} else {
+		fmt.Printf(tr("today: %s of %s")+"  %s\n", formatDuration(done), formatDuration(goal), progressBar(done, goal))
+	}
+
+	if running != nil {
+		e := *running
+		e.End = now
+		entries = append(entries, e)
+	}
+	for _, tag := range budgetTags(budgets) {
+		spent := spentInMonth(entries, tag, now)
+		if percentOf(spent, budgets[tag]) >= budgetAlerts[0] {
+			warnBudget(tag, spent, budgets[tag])
+		}
+	}
+	return nil
+}
+
+// runningEntry returns the begun entry at the end of data, or nil if there
+// is none.
+func runningEntry(data []byte) (*Entry, error) {
+	record, _, _, err := lastRecord(data)
+	if err != nil || record == nil || !begun(record) {
+		return nil, err
+	}
+	e, err := parseEntry(record, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// spentToday returns the time spent in entries and the running entry, if it
+// is not nil, since midnight up to now.
+func spentToday(entries []Entry, running *Entry, now time.Time) time.Duration {
+	y, m, d := now.Date()
+	midnight := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	spent := func(begin, end time.Time) time.Duration {
+		if begin.Before(midnight) {
+			begin = midnight
+		}
+		if end.After(now) {
+			end = now
+		}
+		if end.Before(begin) {
+			return 0
+		}
+		return end.Sub(begin)
+	}
+
+	var sum time.Duration
+	for i := range entries {
+		sum += spent(entries[i].Begin, entries[i].End)
+	}
+	if running != nil {
+		sum += spent(running.Begin, now)
+	}
+	return sum.Round(time.Second)
+}
+
+// progressBar returns a bar that shows how much of goal is done, followed by
+// the percentage, which can be over 100.
+func progressBar(done, goal time.Duration) string {
+	n := int(int64(done) * barWidth / int64(goal))
+	if n > barWidth {
+		n = barWidth
+	}
+	return fmt.Sprintf("[%s%s] %3d%%", strings.Repeat("#", n), strings.Repeat("-", barWidth-n),
+		int64(done)*100/int64(goal))
+}
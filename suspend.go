@@ -0,0 +1,98 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// stopSignals are the signals upon which a waiting entry is completed.
+// Other signals, such as those the Go runtime uses itself, are not meant
+// for track and are ignored.
+var stopSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+// suspendCheck is how often wait checks whether the machine was suspended.
+const suspendCheck = 10 * time.Second
+
+// The ways in which wait can treat the time that the machine was suspended,
+// which are given by the key on-suspend in the configuration.
+const (
+	suspendEnd  = "end"  // complete the entry when the machine was suspended
+	suspendKeep = "keep" // count the suspended time towards the entry
+	suspendAsk  = "ask"  // ask the user on the terminal, or else end
+)
+
+// suspendStrategy returns how the time that the machine was suspended is
+// treated, unless the configuration says otherwise. That is suspendEnd if
+// sleepMeasured, and otherwise suspendKeep, since a suspend cannot be told
+// apart from a change of the wall clock then.
+func suspendStrategy() (string, error) {
+	s, ok := config["on-suspend"]
+	if !ok {
+		if !sleepMeasured {
+			return suspendKeep, nil
+		}
+		return suspendEnd, nil
+	}
+	switch s {
+	case suspendEnd, suspendKeep, suspendAsk:
+		return s, nil
+	}
+	return "", fmt.Errorf(tr("config: unknown on-suspend strategy %q"), s)
+}
+
+// A sleepMeter measures how long the machine was suspended between the
+// times that it is read.
+type sleepMeter struct {
+	last   time.Time     // with a monotonic clock reading
+	asleep time.Duration // the result of asleep at last
+}
+
+func newSleepMeter(now time.Time) *sleepMeter {
+	asleep, _ := asleep()
+	return &sleepMeter{now, asleep}
+}
+
+// since returns how long the machine was suspended since the meter was last
+// read, which is 0 for less than -skew.
+//
+// Where sleepMeasured, the system tells how long it was suspended. Elsewhere
+// the monotonic clock stands still while the machine is suspended, so that
+// the wall clock runs ahead of it, but the same happens when the wall clock
+// is set forward, as by NTP.
+func (m *sleepMeter) since(now time.Time) time.Duration {
+	var gap time.Duration
+	if asleep, ok := asleep(); ok {
+		gap = asleep - m.asleep
+		m.asleep = asleep
+	} else {
+		gap = now.Round(0).Sub(m.last.Round(0)) - now.Sub(m.last)
+	}
+	m.last = now
+	if gap < skewFlag {
+		return 0
+	}
+	return gap
+}
+
+// countSuspended returns true if the time from the suspend at from until the
+// resume at to should count towards the entry, according to strategy.
+func countSuspended(strategy string, from, to time.Time) bool {
+	switch strategy {
+	case suspendKeep:
+		return true
+	case suspendAsk:
+		if fi, err := os.Stdin.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return false
+		}
+		answer, err := ask(fmt.Sprintf(tr("The machine was suspended from %s to %s. Count this time? [y/n] "),
+			from.Format("15:04"), to.Format("15:04")))
+		return err == nil && answer == tr("y")
+	}
+	return false
+}
@@ -0,0 +1,318 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timesheet prints a grid of the hours spent in a week, given by the -week
+// option as an ISO week like 2024-W19 or the current week by default. There
+// is a row for each tag and a column for each day, with the totals of each
+// row in the last column and of each day in the last row. The tag of an
+// entry is its most specific tag, and entries count on the day that they
+// begin. Durations are rounded like in report, and entries are snapped to
+// slots with the -slot option or the configuration, as in report.
+//
+// The -format option gives the format of the grid, which is csv, markdown,
+// or xlsx for a spreadsheet. The layout can be adjusted to the template of
+// an employer with the table [timesheet] in the configuration:
+//
+//	[timesheet]
+//	rows = "clientA:web clientA:support internal"
+//	days = "monday tuesday wednesday thursday friday"
+//	hours = "clock"
+//
+// The rows are always listed first in that order, even if they have no
+// hours, and an entry belongs to the most specific of them that it has. The
+// days are the columns, which are all days of the week by default. Hours
+// are decimal numbers like 1.50 by default, or 1:30 with clock.
+func Timesheet() error {
+	monday, err := parseWeek(weekFlag)
+	if err != nil {
+		return err
+	}
+	days, err := timesheetDays()
+	if err != nil {
+		return err
+	}
+	format := formatFlag
+	if format == "" {
+		format = "csv"
+	}
+	write, ok := timesheetWriters[format]
+	if !ok {
+		return fmt.Errorf(tr("unknown timesheet format %q; the formats are csv, markdown, and xlsx"), format)
+	}
+	hours := config["timesheet.hours"]
+	if hours != "" && hours != "decimal" && hours != "clock" {
+		return fmt.Errorf(tr("config: timesheet.hours is neither decimal nor clock: %q"), hours)
+	}
+	match, err := entryFilter()
+	if err != nil {
+		return err
+	}
+	round, err := loadRounding()
+	if err != nil {
+		return err
+	}
+	slots, err := loadSlots()
+	if err != nil {
+		return err
+	}
+
+	// A row that is configured twice is only listed once.
+	var rows []string
+	listed := make(map[string]bool)
+	cells := make(map[string]*[7]time.Duration)
+	for _, r := range strings.Fields(config["timesheet.rows"]) {
+		if !listed[r] {
+			listed[r] = true
+			rows = append(rows, r)
+			cells[r] = new([7]time.Duration)
+		}
+	}
+	nextMonday := monday.AddDate(0, 0, 7)
+	add := func(e *Entry) {
+		row := specificTag(e, func(t string) bool { return listed[t] })
+		if row == "" {
+			row = nameOf(e)
+		}
+		if cells[row] == nil {
+			cells[row] = new([7]time.Duration)
+			rows = append(rows, row)
+		}
+		d := e.Duration()
+		if round != nil {
+			d = round.Round(d)
+		}
+		cells[row][e.Begin.Weekday()] += d
+	}
+	keep := func(e *Entry) bool {
+		return match(e) && !e.Begin.Before(monday) && e.Begin.Before(nextMonday)
+	}
+	// With slots, all the entries are snapped before they are filtered, so
+	// that the slots are the same as in report and export.
+	var entries []Entry
+	err = scanFile(pathArg, func(e *Entry) bool {
+		if slots != nil {
+			entries = append(entries, *e)
+		} else if keep(e) {
+			add(e)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if slots != nil {
+		for _, e := range slots.snap(entries) {
+			if keep(&e) {
+				add(&e)
+			}
+		}
+	}
+
+	// The rows that are not configured follow in order.
+	extra := rows[len(listed):]
+	sort.Slice(extra, func(i, j int) bool {
+		if extra[i] == untagged || extra[j] == untagged {
+			return extra[j] == untagged && extra[i] != untagged
+		}
+		return lessTag(extra[i], extra[j])
+	})
+
+	cell := func(d time.Duration) string {
+		if hours == "clock" {
+			d = d.Round(time.Minute)
+			return fmt.Sprintf("%d:%02d", int(d.Hours()), int(d.Minutes())%60)
+		}
+		return formatHours(d)
+	}
+	header := []string{tr("tag")}
+	for _, day := range days {
+		date := monday.AddDate(0, 0, (int(day)+6)%7)
+		header = append(header, tr(day.String()[:3])+" "+formatDate(date))
+	}
+	header = append(header, tr("total"))
+	grid := [][]string{header}
+	var sums [7]time.Duration
+	for _, r := range rows {
+		name := r
+		if r == untagged {
+			name = tr(untagged)
+		}
+		line := []string{name}
+		var sum time.Duration
+		for _, day := range days {
+			d := cells[r][day]
+			line = append(line, cell(d))
+			sum += d
+			sums[day] += d
+		}
+		grid = append(grid, append(line, cell(sum)))
+	}
+	footer := []string{tr("total")}
+	var sum time.Duration
+	for _, day := range days {
+		footer = append(footer, cell(sums[day]))
+		sum += sums[day]
+	}
+	grid = append(grid, append(footer, cell(sum)))
+
+	return write(os.Stdout, grid)
+}
+
+// parseWeek returns the beginning of the Monday of the ISO week s, such as
+// 2024-W19, or of the current week if s is "".
+func parseWeek(s string) (time.Time, error) {
+	if s == "" {
+		return startOfWeek(time.Now()), nil
+	}
+	var year, week int
+	if n, err := fmt.Sscanf(s, "%d-W%d", &year, &week); err != nil || n != 2 {
+		return time.Time{}, fmt.Errorf(tr("invalid week %q, which should be like 2024-W19"), s)
+	}
+	// The 4th of January is always in the first week.
+	monday := startOfWeek(time.Date(year, time.January, 4, 0, 0, 0, 0, time.Local)).AddDate(0, 0, (week-1)*7)
+	if y, w := monday.ISOWeek(); y != year || w != week {
+		return time.Time{}, fmt.Errorf(tr("there is no week %d in %d"), week, year)
+	}
+	return monday, nil
+}
+
+// timesheetDays returns the days of the week that are the columns of the
+// timesheet, as given by the key timesheet.days in the configuration.
+func timesheetDays() ([]time.Weekday, error) {
+	names := strings.Fields(config["timesheet.days"])
+	if len(names) == 0 {
+		return []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday,
+			time.Saturday, time.Sunday}, nil
+	}
+	days := make([]time.Weekday, len(names))
+	for i, name := range names {
+		day, ok := weekdayNamed(name)
+		if !ok {
+			return nil, fmt.Errorf(tr("config: timesheet.days: %q is not a day of the week"), name)
+		}
+		days[i] = day
+	}
+	return days, nil
+}
+
+// timesheetWriters write a grid of cells, with a header in the first row, in
+// each format of timesheet.
+var timesheetWriters = map[string]func(w io.Writer, grid [][]string) error{
+	"csv":      writeCSVGrid,
+	"markdown": writeMarkdownGrid,
+	"xlsx":     writeXLSXGrid,
+}
+
+func writeCSVGrid(w io.Writer, grid [][]string) error {
+	writer := csv.NewWriter(w)
+	writer.WriteAll(grid)
+	return writer.Error()
+}
+
+func writeMarkdownGrid(w io.Writer, grid [][]string) error {
+	var b strings.Builder
+	for i, row := range grid {
+		cells := make([]string, len(row))
+		for j, c := range row {
+			cells[j] = markdownCell(c)
+		}
+		fmt.Fprintf(&b, "| %s |\n", strings.Join(cells, " | "))
+		if i == 0 {
+			b.WriteString("| ---")
+			b.WriteString(strings.Repeat(" | ---:", len(row)-1))
+			b.WriteString(" |\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// The parts of a spreadsheet in the Office Open XML format that do not depend
+// on the cells.
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Timesheet" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+)
+
+// writeXLSXGrid writes the grid as a spreadsheet with a single sheet. Cells
+// that are decimal numbers are stored as numbers, so that they can be added
+// up in the spreadsheet, and all others as text.
+func writeXLSXGrid(w io.Writer, grid [][]string) error {
+	var sheet strings.Builder
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for i, row := range grid {
+		fmt.Fprintf(&sheet, `<row r="%d">`, i+1)
+		for j, c := range row {
+			ref := xlsxColumn(j) + strconv.Itoa(i+1)
+			if _, err := strconv.ParseFloat(c, 64); err == nil && i > 0 && j > 0 {
+				fmt.Fprintf(&sheet, `<c r="%s"><v>%s</v></c>`, ref, c)
+			} else {
+				fmt.Fprintf(&sheet, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, html.EscapeString(c))
+			}
+		}
+		sheet.WriteString("</row>")
+	}
+	sheet.WriteString("</sheetData></worksheet>")
+
+	z := zip.NewWriter(w)
+	for _, part := range []struct{ name, data string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/worksheets/sheet1.xml", sheet.String()},
+	} {
+		f, err := z.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(f, part.data); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// xlsxColumn returns the name of the column with index i, counting from 0,
+// such as A or AB.
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
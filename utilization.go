@@ -0,0 +1,172 @@
+// Copyright (c) 2013, Ben Morgan. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Utilization prints how much of the available working time was tracked,
+// for the entries that match the filter options. The available time is what
+// the schedule plans, which leaves out the holidays; see loadSchedule.
+//
+// The time is given for each week of the days from -from to -to, or for
+// each month with -group-by month, followed by the time of each tag. An
+// entry counts on the day that it begins. Like in report, every level of a
+// hierarchical tag gets a subtotal, and an entry with several tags counts
+// towards each of them. The days default to the current month up to today,
+// or with only -to to the month of that day up to it.
+func Utilization() error {
+	var periodOf func(day time.Time) string
+	switch groupByFlag {
+	case "tag", "week":
+		periodOf = func(day time.Time) string {
+			year, week := day.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", year, week)
+		}
+	case "month":
+		periodOf = func(day time.Time) string {
+			return day.Format("2006-01")
+		}
+	default:
+		return fmt.Errorf(tr("cannot group by %q"), groupByFlag)
+	}
+	match, err := entryFilter()
+	if err != nil {
+		return err
+	}
+	sched, err := loadSchedule()
+	if err != nil {
+		return err
+	}
+	paths, err := filePaths()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	from, end := startOfMonth(now), startOfDay(now).AddDate(0, 0, 1)
+	if toFlag != "" {
+		to, _ := time.ParseInLocation(dateFormat, toFlag, time.Local)
+		from, end = startOfMonth(to), to.AddDate(0, 0, 1)
+	}
+	if fromFlag != "" {
+		from, _ = time.ParseInLocation(dateFormat, fromFlag, time.Local)
+	}
+	if !from.Before(end) {
+		return fmt.Errorf(tr("%s lies after %s, so there are no days"), from.Format(dateFormat),
+			end.AddDate(0, 0, -1).Format(dateFormat))
+	}
+	var periods []string
+	available := make(map[string]time.Duration)
+	for day := from; day.Before(end); day = day.AddDate(0, 0, 1) {
+		p := periodOf(day)
+		if len(periods) == 0 || periods[len(periods)-1] != p {
+			periods = append(periods, p)
+		}
+		available[p] += sched.on(day)
+		available[""] += sched.on(day)
+	}
+
+	tracked := make([]map[string]time.Duration, len(paths))
+	tagged := make([]map[string]time.Duration, len(paths))
+	for i := range paths {
+		tracked[i] = make(map[string]time.Duration)
+		tagged[i] = make(map[string]time.Duration)
+	}
+	err = scanFiles(paths, func(i int, e *Entry) bool {
+		if !match(e) || e.Begin.Before(from) || !e.Begin.Before(end) {
+			return true
+		}
+		d := e.Duration()
+		tracked[i][periodOf(e.Begin)] += d
+		tracked[i][""] += d
+		seen := make(map[string]bool)
+		for _, t := range e.Tags {
+			if t == billableTag {
+				continue
+			}
+			for _, a := range ancestors(t) {
+				if !seen[a] {
+					seen[a] = true
+					tagged[i][a] += d
+				}
+			}
+		}
+		if len(seen) == 0 {
+			tagged[i][untagged] += d
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	sums := make(map[string]time.Duration)
+	tags := make(map[string]time.Duration)
+	for i := range paths {
+		for p, d := range tracked[i] {
+			sums[p] += d
+		}
+		for t, d := range tagged[i] {
+			tags[t] += d
+		}
+	}
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i] == untagged || keys[j] == untagged {
+			return keys[j] == untagged && keys[i] != untagged
+		}
+		return lessTag(keys[i], keys[j])
+	})
+
+	share := func(d, total time.Duration) string {
+		if total <= 0 {
+			return "-"
+		}
+		return fmt.Sprintf("%d%%", percentOf(d, total))
+	}
+	// The spaces that the line between the periods and the tags is padded
+	// with are trimmed, like in report.
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "\t%s\t%s\t%s\n", tr("available"), tr("tracked"), tr("utilization"))
+	for _, p := range periods {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p, formatDuration(available[p]), formatDuration(sums[p]),
+			share(sums[p], available[p]))
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", tr("total"), formatDuration(available[""]), formatDuration(sums[""]),
+		share(sums[""], available[""]))
+	if len(keys) > 0 {
+		// The empty cells of the line in between keep the time of the
+		// tags aligned with the tracked time of the periods.
+		fmt.Fprintln(w, "\t\t\t")
+		for _, k := range keys {
+			name := tr(untagged)
+			if k != untagged {
+				depth := strings.Count(k, tagSep)
+				name = strings.Repeat("  ", depth) + k[strings.LastIndex(k, tagSep)+1:]
+			}
+			fmt.Fprintf(w, "%s\t\t%s\t%s\n", name, formatDuration(tags[k]), share(tags[k], available[""]))
+		}
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line != "" {
+			fmt.Println(strings.TrimRight(line, " \n"))
+		}
+	}
+	return nil
+}